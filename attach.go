@@ -1,20 +1,50 @@
 package docker
 
 import (
+	"io"
 	"net/http/httputil"
+	"sync"
 
 	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
 )
 
+// Attach attaches the client's standard streams to the container.
 func (c *Container) Attach() error {
 	client := c.client
+
+	var stdin io.ReadCloser
+	if client.options.stdin != nil {
+		stdin = client.options.stdin
+	}
+	var stdout, stderr io.Writer
+	if client.options.stdout != nil {
+		stdout = client.options.stdout
+		if w := client.options.lineWriter(stdout, LinePrefix{ContainerID: c.ID, Stream: StdoutStream}); w != nil {
+			defer w.Close()
+			stdout = w
+		}
+	}
+	if client.options.stderr != nil {
+		stderr = client.options.stderr
+		if w := client.options.lineWriter(stderr, LinePrefix{ContainerID: c.ID, Stream: StderrStream}); w != nil {
+			defer w.Close()
+			stderr = w
+		}
+	}
+	return c.AttachStreams(stdin, stdout, stderr)
+}
+
+// AttachStreams attaches the given streams to the container. A nil stream is
+// not attached.
+func (c *Container) AttachStreams(stdin io.ReadCloser, stdout, stderr io.Writer) error {
+	client := c.client
 	ctx := c.options.context
 	attachOpts := types.ContainerAttachOptions{
 		Stream: true,
-		Stdin:  client.options.stdin != nil,
-		Stdout: client.options.stdout != nil,
-		Stderr: client.options.stderr != nil,
+		Stdin:  stdin != nil,
+		Stdout: stdout != nil,
+		Stderr: stderr != nil,
 		Logs:   true,
 	}
 
@@ -38,23 +68,84 @@ func (c *Container) Attach() error {
 		return errAttach
 	}
 
+	// the limits are exceeded by the copy of the output, which may outlive
+	// the hijacked connection when the context is canceled
+	var limitMu sync.Mutex
+	var limitErr *OutputLimitError
+	var limitWriters []*limitWriter
+	limit := func(stream string, out io.Writer, l OutputLimit) io.Writer {
+		if l.IsZero() || out == nil {
+			return out
+		}
+		w := newLimitWriter(stream, out, l, func(stream string) {
+			if l.Policy != LimitKill {
+				return
+			}
+			limitMu.Lock()
+			limitErr = &OutputLimitError{Stream: stream, Limit: l}
+			limitMu.Unlock()
+			go func() {
+				if err := c.kill(); err != nil {
+					log.WithError(err).
+						WithField("container_id", c.ID).
+						WithField("stream", stream).
+						Error("failed to kill container exceeding its output limit")
+				}
+			}()
+		})
+		limitWriters = append(limitWriters, w)
+		return w
+	}
+
+	stdout = limit(StdoutStream, stdout, c.options.stdoutLimit)
+	stderr = limit(StderrStream, stderr, c.options.stderrLimit)
+	c.setLimitExceeded(nil)
+
 	strm := &stream{
-		stdin:  client.options.stdin,
-		stdout: client.options.stdout,
-		stderr: client.options.stderr,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
 	}
 
 	errHijack := holdHijackedConnection(
 		ctx,
 		strm,
 		c.options.containerConfig.Tty,
-		client.options.stdin,
-		client.options.stdout,
-		client.options.stderr,
+		stdin,
+		stdout,
+		stderr,
 		resp,
 	)
+	var exceeded []string
+	for _, w := range limitWriters {
+		w.Flush()
+		if w.Exceeded() {
+			exceeded = append(exceeded, w.stream)
+		}
+	}
+	c.setLimitExceeded(exceeded)
 	if errHijack == nil {
+		limitMu.Lock()
+		defer limitMu.Unlock()
+		if limitErr != nil {
+			return limitErr
+		}
 		return errAttach
 	}
 	return errHijack
 }
+
+// OutputLimitExceeded lists the streams that exceeded their output limit
+// during the last attach. Streams using the LimitKill policy also make
+// AttachStreams return an OutputLimitError.
+func (c *Container) OutputLimitExceeded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limitExceeded
+}
+
+func (c *Container) setLimitExceeded(streams []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.limitExceeded = streams
+}
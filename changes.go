@@ -0,0 +1,222 @@
+package docker
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+)
+
+// ChangeKind is the kind of change made to a file of a container. The values
+// match the ones reported by the daemon.
+type ChangeKind uint8
+
+const (
+	ChangeModified ChangeKind = iota
+	ChangeAdded
+	ChangeDeleted
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeModified:
+		return "modified"
+	case ChangeAdded:
+		return "added"
+	case ChangeDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is a file of the container that changed since it was created from
+// its image
+type Change struct {
+	Kind ChangeKind
+	Path string
+	// Archived is true if the content of the file was written to the
+	// contents archive
+	Archived bool
+}
+
+type ChangesOptions struct {
+	prefixes       []string
+	contents       io.Writer
+	contentsBudget int64
+}
+
+type ChangesOption func(*ChangesOptions)
+
+// ChangesPrefix only reports the changes under one of the paths
+func ChangesPrefix(prefixes ...string) ChangesOption {
+	return func(o *ChangesOptions) {
+		for _, p := range prefixes {
+			o.prefixes = append(o.prefixes, path.Clean("/"+p))
+		}
+	}
+}
+
+// ChangesContents writes a tar archive of the added and modified regular
+// files to w. The files that do not fit in the remaining budget of maxBytes
+// are left out of the archive.
+func ChangesContents(w io.Writer, maxBytes int64) ChangesOption {
+	return func(o *ChangesOptions) {
+		o.contents = w
+		o.contentsBudget = maxBytes
+	}
+}
+
+// Changes returns the files of the container that were added, modified or
+// deleted, sorted by path.
+func (c *Container) Changes(paramOpts ...ChangesOption) ([]Change, error) {
+	opts := &ChangesOptions{}
+	for _, o := range paramOpts {
+		o(opts)
+	}
+
+	items, err := c.client.ContainerDiff(c.options.context, c.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to diff container %v", c.ID)
+	}
+	changes := filterChanges(items, opts.prefixes)
+
+	if opts.contents != nil {
+		if err := c.archiveChanges(changes, opts.contents, opts.contentsBudget); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+func filterChanges(items []container.ContainerChangeResponseItem, prefixes []string) []Change {
+	changes := []Change{}
+	for _, item := range items {
+		if len(prefixes) != 0 && !hasPathPrefix(item.Path, prefixes) {
+			continue
+		}
+		changes = append(changes, Change{
+			Kind: ChangeKind(item.Kind),
+			Path: item.Path,
+		})
+	}
+	sort.Slice(changes, func(ii, jj int) bool {
+		return changes[ii].Path < changes[jj].Path
+	})
+	return changes
+}
+
+func hasPathPrefix(p string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix == "/" || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveChanges writes the content of the changed regular files that fit in
+// the budget to a tar archive. The files are copied from the container with
+// one archive per group of changes.
+func (c *Container) archiveChanges(changes []Change, w io.Writer, budget int64) error {
+	tw := tar.NewWriter(w)
+	pending := map[string]*Change{}
+	for ii := range changes {
+		if changes[ii].Kind != ChangeDeleted {
+			pending[changes[ii].Path] = &changes[ii]
+		}
+	}
+	for _, group := range changeGroups(changes) {
+		rc, err := c.CopyFromContainer(group)
+		if err != nil {
+			if errdefs.IsNotFound(errors.Cause(err)) {
+				// the files may have been removed since the diff
+				log.WithError(err).WithField("path", group).Debug("failed to copy changed files")
+				continue
+			}
+			return err
+		}
+		budget, err = archiveChangedFiles(tw, rc, path.Dir(group), pending, budget)
+		rc.Close()
+		if err != nil {
+			return errors.Wrapf(err, "failed to archive the changes of %v", group)
+		}
+	}
+	return tw.Close()
+}
+
+// changeGroups returns the paths to copy from the container to get the
+// content of the changes. The changed files are grouped by their parent
+// directory, and the directories are merged with their ancestors, except for
+// the root which is never copied as a whole.
+func changeGroups(changes []Change) []string {
+	ancestors := map[string]bool{}
+	for _, change := range changes {
+		if change.Kind == ChangeDeleted {
+			continue
+		}
+		for dir := path.Dir(change.Path); dir != "/" && !ancestors[dir]; dir = path.Dir(dir) {
+			ancestors[dir] = true
+		}
+	}
+	dirs := map[string]bool{}
+	for _, change := range changes {
+		if change.Kind == ChangeDeleted || ancestors[change.Path] {
+			continue
+		}
+		dir := path.Dir(change.Path)
+		if dir == "/" {
+			dir = change.Path
+		}
+		dirs[dir] = true
+	}
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+
+	groups := []string{}
+	for _, dir := range sorted {
+		if !hasPathPrefix(dir, groups) {
+			groups = append(groups, dir)
+		}
+	}
+	return groups
+}
+
+// archiveChangedFiles copies the pending regular files of the archive that
+// fit in the budget to the tar writer and returns the remaining budget. The
+// entries of the archive are relative to the parent directory.
+func archiveChangedFiles(tw *tar.Writer, r io.Reader, parent string, pending map[string]*Change, budget int64) (int64, error) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return budget, nil
+		}
+		if err != nil {
+			return budget, err
+		}
+		p := path.Join(parent, hdr.Name)
+		change, ok := pending[p]
+		if !ok || hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA || hdr.Size > budget {
+			continue
+		}
+		delete(pending, p)
+		hdr.Name = strings.TrimPrefix(p, "/")
+		if err := tw.WriteHeader(hdr); err != nil {
+			return budget, err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return budget, err
+		}
+		change.Archived = true
+		budget -= hdr.Size
+	}
+}
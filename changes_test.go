@@ -0,0 +1,116 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterChanges(t *testing.T) {
+	items := []container.ContainerChangeResponseItem{
+		{Kind: 1, Path: "/src/main.go"},
+		{Kind: 0, Path: "/src"},
+		{Kind: 2, Path: "/etc/motd"},
+		{Kind: 1, Path: "/srcfoo"},
+	}
+
+	changes := filterChanges(items, nil)
+	assert.Len(t, changes, 4)
+	assert.Equal(t, "/etc/motd", changes[0].Path)
+	assert.Equal(t, ChangeDeleted, changes[0].Kind)
+
+	opts := &ChangesOptions{}
+	ChangesPrefix("src")(opts)
+	changes = filterChanges(items, opts.prefixes)
+	assert.Equal(t, []Change{
+		{Kind: ChangeModified, Path: "/src"},
+		{Kind: ChangeAdded, Path: "/src/main.go"},
+	}, changes)
+	assert.Equal(t, "added", changes[1].Kind.String())
+}
+
+func TestChangesGroups(t *testing.T) {
+	changes := []Change{
+		{Kind: ChangeAdded, Path: "/top.txt"},
+		{Kind: ChangeModified, Path: "/work"},
+		{Kind: ChangeAdded, Path: "/work/a.txt"},
+		{Kind: ChangeDeleted, Path: "/work/gone"},
+		{Kind: ChangeDeleted, Path: "/work/gone/old.txt"},
+		{Kind: ChangeModified, Path: "/work/sub"},
+		{Kind: ChangeAdded, Path: "/work/sub/c.txt"},
+		{Kind: ChangeModified, Path: "/var/log"},
+		{Kind: ChangeAdded, Path: "/var/log/app.log"},
+	}
+	assert.Equal(t, []string{"/top.txt", "/var/log", "/work"}, changeGroups(changes))
+}
+
+func TestChangesContentsBudget(t *testing.T) {
+	var mu sync.Mutex
+	copied := []string{}
+	archives := map[string]*bytes.Buffer{
+		"/work": tarArchive(t,
+			&tar.Header{Name: "work/", Typeflag: tar.TypeDir, Mode: 0755},
+			&tar.Header{Name: "work/a.txt", Typeflag: tar.TypeReg, Mode: 0644},
+			&tar.Header{Name: "work/big-file-too-large.bin", Typeflag: tar.TypeReg, Mode: 0644},
+			&tar.Header{Name: "work/sub/", Typeflag: tar.TypeDir, Mode: 0755},
+			&tar.Header{Name: "work/sub/c.txt", Typeflag: tar.TypeReg, Mode: 0644},
+			&tar.Header{Name: "work/unchanged.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		),
+		"/top.txt": tarArchive(t, &tar.Header{Name: "top.txt", Typeflag: tar.TypeReg, Mode: 0644}),
+	}
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/c1/json": writeJSON(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", State: &types.ContainerState{Status: "exited"}},
+		}),
+		"GET /containers/c1/changes": writeJSON([]container.ContainerChangeResponseItem{
+			{Kind: 0, Path: "/work"},
+			{Kind: 1, Path: "/work/a.txt"},
+			{Kind: 1, Path: "/work/big-file-too-large.bin"},
+			{Kind: 2, Path: "/work/gone.txt"},
+			{Kind: 0, Path: "/work/sub"},
+			{Kind: 1, Path: "/work/sub/c.txt"},
+			{Kind: 1, Path: "/top.txt"},
+		}),
+		"GET /containers/c1/archive": func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Query().Get("path")
+			mu.Lock()
+			copied = append(copied, p)
+			mu.Unlock()
+			stat, _ := json.Marshal(types.ContainerPathStat{Name: p})
+			w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+			w.Write(archives[p].Bytes())
+		},
+	})
+	defer d.Close()
+	defer client.Close()
+	options := NewContainerOptions(client)
+	defer options.cancelFunc()
+	cont := &Container{ID: "c1", client: client, options: *options}
+
+	// the large file does not fit in the budget left by the others
+	contents := &bytes.Buffer{}
+	changes, err := cont.Changes(ChangesContents(contents, 33))
+	require.NoError(t, err)
+
+	archived := []string{}
+	for _, change := range changes {
+		if change.Archived {
+			archived = append(archived, change.Path)
+		}
+	}
+	assert.Equal(t, []string{"/top.txt", "/work/a.txt", "/work/sub/c.txt"}, archived)
+	assert.Equal(t, []string{"top.txt", "work/a.txt", "work/sub/c.txt"}, archiveNames(t, contents))
+	// the files are copied with one archive per group
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"/top.txt", "/work"}, copied)
+}
@@ -1,7 +1,9 @@
 package docker
 
 import (
+	"net"
 	"net/http"
+	"net/url"
 
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
@@ -15,6 +17,8 @@ type Client struct {
 	*dc.Client
 	transport *http.Transport
 	options   ClientOptions
+	adopted   []*Container
+	hub       eventHub
 }
 
 func NewClient(paramOpts ...ClientOption) (*Client, error) {
@@ -38,10 +42,25 @@ func NewClient(paramOpts ...ClientOption) (*Client, error) {
 		log.WithError(err).Error("Not able to create docker client")
 		return nil, err
 	}
-	return &Client{
+	res := &Client{
 		Client:  client,
 		options: *opts,
-	}, nil
+	}
+	if opts.journal != nil {
+		reconciled, err := res.ReconcileJournal()
+		if err != nil {
+			log.WithError(err).Error("Not able to reconcile the journal")
+			return nil, err
+		}
+		res.adopted = reconciled.Adopted
+	}
+	return res, nil
+}
+
+// AdoptedContainers returns the live containers of the journal that were
+// adopted when the client was created.
+func (c *Client) AdoptedContainers() []*Container {
+	return c.adopted
 }
 
 func parseImageName(refName string) (string, error) {
@@ -130,6 +149,23 @@ func (c *Client) RemoveImage(refName string) error {
 	return err
 }
 
+// isLocalDaemon returns true if the daemon listens on a socket of this host or
+// on the loopback interface, so that the pids it reports are host pids
+func (c *Client) isLocalDaemon() bool {
+	u, err := url.Parse(c.DaemonHost())
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "unix", "npipe":
+		return true
+	case "tcp", "http", "https":
+		ip := net.ParseIP(u.Hostname())
+		return u.Hostname() == "localhost" || (ip != nil && ip.IsLoopback())
+	}
+	return false
+}
+
 func (c *Client) Close() error {
 	if c.transport != nil {
 		c.transport.CloseIdleConnections()
@@ -18,7 +18,12 @@ type ClientOptions struct {
 	stderr     *OutStream
 	stdout     *OutStream
 	stdin      *InStream
+	lineOutput bool
+	linePrefix LinePrefixFunc
 	context    context.Context
+
+	lifecycleHooks []LifecycleHook
+	journal        *Journal
 }
 
 type ClientOption func(*ClientOptions)
@@ -115,6 +120,24 @@ func Stdin(stdin io.Reader) ClientOption {
 	}
 }
 
+// LineOutput makes executions and attached containers write to the client's
+// stdout and stderr one complete line at a time, prefixed using the given
+// function. If prefix is nil, lines are written without a prefix.
+func LineOutput(prefix LinePrefixFunc) ClientOption {
+	return func(o *ClientOptions) {
+		o.lineOutput = true
+		o.linePrefix = prefix
+	}
+}
+
+// lineWriter returns a line writer for out, or nil if line output is disabled
+func (o ClientOptions) lineWriter(out io.Writer, prefix LinePrefix) *LineWriter {
+	if !o.lineOutput || out == nil {
+		return nil
+	}
+	return NewLineWriter(out, prefix, o.linePrefix)
+}
+
 func ClientContext(ctx context.Context) ClientOption {
 	return func(o *ClientOptions) {
 		o.context = ctx
@@ -1,11 +1,14 @@
 package docker
 
 import (
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/docker/docker/api"
+	"github.com/docker/docker/api/types/blkiodev"
 	"github.com/docker/docker/client"
+	units "github.com/docker/go-units"
 	humanize "github.com/dustin/go-humanize"
 	"github.com/k0kubun/pp"
 	"github.com/rai-project/config"
@@ -13,17 +16,38 @@ import (
 )
 
 type dockerConfig struct {
-	TimeLimit         time.Duration     `json:"time_limit" config:"docker.time_limit" default:"1h"`
-	Image             string            `json:"image" config:"docker.image" default:"ubuntu:16.04"`
-	Username          string            `json:"username" config:"docker.username" default:"root"`
-	MemoryLimitString string            `json:"memory_limit" config:"docker.memory_limit" default:"16gb"`
-	MemoryLimit       int64             `json:"-" config:"-"`
-	Env               map[string]string `json:"env" config:"docker.env"`
-	Host              string            `json:"host" config:"docker.host" default:"default" env:"DOCKER_HOST"`
-	APIVersion        string            `json:"api_version" config:"docker.api_version" default:"default" env:"DOCKER_API_VERSION"`
-	CertPath          string            `json:"cert_path" config:"docker.cert_path" default:"" env:"DOCKER_CERT_PATH"`
-	TLSVerify         bool              `json:"tls_verify" config:"docker.tls_verify" default:"false" env:"DOCKER_TLS_VERIFY"`
-	done              chan struct{}     `json:"-" config:"-"`
+	TimeLimit         time.Duration `json:"time_limit" config:"docker.time_limit" default:"1h"`
+	StopSignal        string        `json:"stop_signal" config:"docker.stop_signal"`
+	StopGracePeriod   time.Duration `json:"stop_grace_period" config:"docker.stop_grace_period" default:"30s"`
+	Image             string        `json:"image" config:"docker.image" default:"ubuntu:16.04"`
+	Username          string        `json:"username" config:"docker.username" default:"root"`
+	MemoryLimitString string        `json:"memory_limit" config:"docker.memory_limit" default:"16gb"`
+	MemoryLimit       int64         `json:"-" config:"-"`
+	// the resource limits below are not applied when left empty
+	CPUs                    float64                    `json:"cpus" config:"docker.cpus"`
+	CpusetCpus              string                     `json:"cpuset_cpus" config:"docker.cpuset_cpus"`
+	CpusetMems              string                     `json:"cpuset_mems" config:"docker.cpuset_mems"`
+	PidsLimit               int64                      `json:"pids_limit" config:"docker.pids_limit"`
+	UlimitStrings           map[string]string          `json:"ulimits" config:"docker.ulimits"`
+	Ulimits                 []*units.Ulimit            `json:"-" config:"-"`
+	ShmSizeString           string                     `json:"shm_size" config:"docker.shm_size"`
+	ShmSize                 int64                      `json:"-" config:"-"`
+	MemoryReservationString string                     `json:"memory_reservation" config:"docker.memory_reservation"`
+	MemoryReservation       int64                      `json:"-" config:"-"`
+	MemorySwapString        string                     `json:"memory_swap" config:"docker.memory_swap"`
+	MemorySwap              int64                      `json:"-" config:"-"`
+	BlkioWeight             int                        `json:"blkio_weight" config:"docker.blkio_weight"`
+	DeviceReadBpsStrings    map[string]string          `json:"device_read_bps" config:"docker.device_read_bps"`
+	DeviceReadBps           []*blkiodev.ThrottleDevice `json:"-" config:"-"`
+	DeviceWriteBpsStrings   map[string]string          `json:"device_write_bps" config:"docker.device_write_bps"`
+	DeviceWriteBps          []*blkiodev.ThrottleDevice `json:"-" config:"-"`
+	SecurityProfile         string                     `json:"security_profile" config:"docker.security_profile"`
+	Env                     map[string]string          `json:"env" config:"docker.env"`
+	Host                    string                     `json:"host" config:"docker.host" default:"default" env:"DOCKER_HOST"`
+	APIVersion              string                     `json:"api_version" config:"docker.api_version" default:"default" env:"DOCKER_API_VERSION"`
+	CertPath                string                     `json:"cert_path" config:"docker.cert_path" default:"" env:"DOCKER_CERT_PATH"`
+	TLSVerify               bool                       `json:"tls_verify" config:"docker.tls_verify" default:"false" env:"DOCKER_TLS_VERIFY"`
+	done                    chan struct{}              `json:"-" config:"-"`
 }
 
 var (
@@ -43,13 +67,22 @@ func (a *dockerConfig) SetDefaults() {
 func (a *dockerConfig) Read() {
 	defer close(a.done)
 	vipertags.Fill(a)
-	if a.MemoryLimitString != "" {
-		if bts, err := humanize.ParseBytes(a.MemoryLimitString); err == nil {
-			a.MemoryLimit = int64(bts)
-		} else if bts, err := strconv.ParseInt(a.MemoryLimitString, 10, 0); err == nil {
-			a.MemoryLimit = bts
-		}
+	if bts, ok := parseBytes("memory_limit", a.MemoryLimitString); ok {
+		a.MemoryLimit = bts
+	}
+	if bts, ok := parseBytes("shm_size", a.ShmSizeString); ok {
+		a.ShmSize = bts
+	}
+	if bts, ok := parseBytes("memory_reservation", a.MemoryReservationString); ok {
+		a.MemoryReservation = bts
 	}
+	if bts, ok := parseBytes("memory_swap", a.MemorySwapString); ok {
+		a.MemorySwap = bts
+	}
+	a.BlkioWeight = parseBlkioWeight(a.BlkioWeight)
+	a.Ulimits = parseUlimits(a.UlimitStrings)
+	a.DeviceReadBps = parseThrottleDevices("device_read_bps", a.DeviceReadBpsStrings)
+	a.DeviceWriteBps = parseThrottleDevices("device_write_bps", a.DeviceWriteBpsStrings)
 	if a.Host == "" || a.Host == "default" {
 		a.Host = client.DefaultDockerHost
 	}
@@ -58,6 +91,83 @@ func (a *dockerConfig) Read() {
 	}
 }
 
+// parseBytes parses a human readable size, such as 4gb, or a number of bytes.
+// Invalid sizes of the configuration key are logged and ignored.
+func parseBytes(key, s string) (int64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if bts, err := humanize.ParseBytes(s); err == nil {
+		return int64(bts), true
+	}
+	bts, err := strconv.ParseInt(s, 10, 0)
+	if err != nil {
+		log.WithError(err).
+			WithField("key", key).
+			WithField("value", s).
+			Error("Invalid size")
+		return 0, false
+	}
+	return bts, true
+}
+
+// parseBlkioWeight checks that the block IO weight is between 10 and 1000.
+// Invalid weights are logged and ignored.
+func parseBlkioWeight(w int) int {
+	if w != 0 && !validBlkioWeight(w) {
+		log.WithField("key", "blkio_weight").
+			WithField("value", w).
+			Error("Invalid blkio weight")
+		return 0
+	}
+	return w
+}
+
+// parseUlimits parses ulimits given as soft:hard, or as a single value used
+// for both, indexed by name. Invalid ulimits are logged and ignored.
+func parseUlimits(limits map[string]string) []*units.Ulimit {
+	res := []*units.Ulimit{}
+	for name, val := range limits {
+		ulimit, err := units.ParseUlimit(name + "=" + val)
+		if err != nil {
+			log.WithError(err).
+				WithField("ulimit", name).
+				WithField("value", val).
+				Error("Invalid ulimit")
+			continue
+		}
+		res = append(res, ulimit)
+	}
+	sort.Slice(res, func(ii, jj int) bool {
+		return res[ii].Name < res[jj].Name
+	})
+	return res
+}
+
+// parseThrottleDevices parses the human readable rates indexed by device path.
+// Invalid rates of the configuration key are logged and ignored.
+func parseThrottleDevices(key string, rates map[string]string) []*blkiodev.ThrottleDevice {
+	res := []*blkiodev.ThrottleDevice{}
+	for path, rate := range rates {
+		bts, ok := parseBytes(key, rate)
+		if !ok {
+			continue
+		}
+		if bts < 0 {
+			log.WithField("key", key).
+				WithField("device", path).
+				WithField("value", rate).
+				Error("Invalid negative rate")
+			continue
+		}
+		res = append(res, &blkiodev.ThrottleDevice{Path: path, Rate: uint64(bts)})
+	}
+	sort.Slice(res, func(ii, jj int) bool {
+		return res[ii].Path < res[jj].Path
+	})
+	return res
+}
+
 func (c dockerConfig) Wait() {
 	<-c.done
 }
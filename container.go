@@ -2,20 +2,31 @@ package docker
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
 )
 
 type Container struct {
-	ID        string
-	isStarted bool
-	client    *Client
-	options   ContainerOptions
+	ID           string
+	client       *Client
+	options      ContainerOptions
+	cancelEvents context.CancelFunc
+	mu           sync.Mutex
+	state        ContainerState
+	// limitExceeded lists the streams over their limit in the last attach
+	limitExceeded []string
 }
 
 func NewContainer(client *Client, paramOpts ...ContainerOption) (*Container, error) {
 	options := NewContainerOptions(client, paramOpts...)
+	if options.err != nil {
+		options.cancelFunc()
+		return nil, options.err
+	}
 
 	if !client.HasImage(options.containerConfig.Image) {
 		err := client.PullImage(options.containerConfig.Image)
@@ -23,6 +34,7 @@ func NewContainer(client *Client, paramOpts ...ContainerOption) (*Container, err
 			return nil, err
 		}
 	}
+	options.recordLabels(client)
 	c, err := client.ContainerCreate(
 		options.context,
 		options.containerConfig,
@@ -37,15 +49,30 @@ func NewContainer(client *Client, paramOpts ...ContainerOption) (*Container, err
 		ID:      c.ID,
 		client:  client,
 		options: *options,
+		state:   StateCreated,
 	}
+	container.journalCreated()
+	container.emit(LifecycleEvent{Type: ContainerCreated})
+	container.supervise()
+	return container, nil
+}
+
+// supervise tracks the daemon events of the container and stops it once its
+// time limit is exceeded.
+func (c *Container) supervise() {
+	// the events outlive the options context since the container dies while
+	// being stopped
+	ctx, cancel := context.WithCancel(c.options.parentCtx)
+	c.cancelEvents = cancel
+	go c.watchDaemonEvents(ctx)
 	go func() {
-		ctx := container.options.context
+		ctx := c.options.context
 		<-ctx.Done()
 		if ctx.Err() == context.DeadlineExceeded {
-			container.Stop()
+			c.emit(LifecycleEvent{Type: ContainerTimedOut})
+			c.Stop()
 		}
 	}()
-	return container, nil
 }
 
 func (c *Container) Start() error {
@@ -58,10 +85,79 @@ func (c *Container) Start() error {
 	if err != nil {
 		return err
 	}
-	c.isStarted = true
+	c.setState(StateRunning)
+	c.emit(LifecycleEvent{Type: ContainerStarted})
 	return nil
 }
 
+// ErrTimelimitExceeded is returned when the time limit of the container
+// expired while waiting for it.
+var ErrTimelimitExceeded = errors.New("Docker container:: time limit exceeded")
+
+// WaitResult describes how the main process of a container exited
+type WaitResult struct {
+	ExitCode   int
+	OOMKilled  bool
+	Error      string
+	FinishedAt time.Time
+}
+
+// Wait blocks until the container reaches the given condition, which defaults
+// to container.WaitConditionNotRunning, and reports how its main process
+// exited. ErrTimelimitExceeded is returned if the time limit of the container
+// expires first.
+func (c *Container) Wait(ctx context.Context, condition container.WaitCondition) (WaitResult, error) {
+	if condition == "" {
+		condition = container.WaitConditionNotRunning
+	}
+	client := c.client
+
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	waitc, errc := client.ContainerWait(waitCtx, c.ID, condition)
+
+	var res WaitResult
+	select {
+	case body := <-waitc:
+		res.ExitCode = int(body.StatusCode)
+		if body.Error != nil {
+			res.Error = body.Error.Message
+		}
+	case err := <-errc:
+		if ctx.Err() != nil {
+			return res, ctx.Err()
+		}
+		if c.options.context.Err() == context.DeadlineExceeded {
+			return res, ErrTimelimitExceeded
+		}
+		return res, errors.Wrapf(err, "failed to wait for container %v", c.ID)
+	case <-c.options.context.Done():
+		if c.options.context.Err() == context.DeadlineExceeded {
+			return res, ErrTimelimitExceeded
+		}
+		return res, c.options.context.Err()
+	case <-ctx.Done():
+		return res, ctx.Err()
+	}
+
+	info, err := client.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		// the container is gone when waiting for its removal
+		return res, nil
+	}
+	if info.State != nil {
+		res.OOMKilled = info.State.OOMKilled
+		if res.Error == "" {
+			res.Error = info.State.Error
+		}
+		if t, err := time.Parse(time.RFC3339Nano, info.State.FinishedAt); err == nil {
+			res.FinishedAt = t
+		}
+	}
+	return res, nil
+}
+
 func (c *Container) Info() (types.ContainerJSON, error) {
 	client := c.client
 	info, err := client.ContainerInspect(
@@ -78,33 +174,9 @@ func (c *Container) Close() error {
 	return c.Stop()
 }
 
+// Stop stops and removes the container using the default stop options.
 func (c *Container) Stop() error {
-	defer func() {
-		c.options.cancelFunc()
-		c.isStarted = false
-	}()
-	if c.options.visibleGPUs != nil && GPUDeviceUsageState != nil {
-		for key, val := range c.options.visibleGPUs {
-			GPUDeviceUsageState.Add(key, val)
-		}
-	}
-	if c.isStarted {
-		// if err := c.stop(); err != nil {
-		// 	log.WithError(err).Errorf("failed to stop container %v", c.ID)
-		// }
-		// if err := c.kill(); err != nil {
-		// 	log.WithError(err).Errorf("failed to stop container %v", c.ID)
-		// }
-		c.stop()
-		c.kill()
-	}
-	return c.remove()
-}
-
-func (c *Container) stop() error {
-	containerStopTimeout := 30 * time.Second
-	err := c.client.ContainerStop(context.TODO(), c.ID, &containerStopTimeout)
-	return err
+	return c.StopWithOptions()
 }
 
 func (c *Container) killWithSignal(sig string) error {
@@ -121,20 +193,6 @@ func (c *Container) kill() error {
 	return c.killWithSignal("SIGKILL")
 }
 
-func (c *Container) remove() error {
-	client := c.client
-	err := client.ContainerRemove(
-		c.options.context,
-		c.ID,
-		types.ContainerRemoveOptions{
-			RemoveVolumes: true,
-			// RemoveLinks:   true,
-			Force: true,
-		},
-	)
-	return err
-}
-
 func (c *Container) Options() ContainerOptions {
 	return c.options
 }
@@ -7,11 +7,14 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/strslice"
+	units "github.com/docker/go-units"
 	"github.com/imdario/mergo"
 	"github.com/pkg/errors"
 	"github.com/rai-project/config"
@@ -22,19 +25,35 @@ import (
 )
 
 type ContainerOptions struct {
-	name            string
-	runtime         string
-	visibleGPUs     map[string]int
-	containerConfig *container.Config
-	hostConfig      *container.HostConfig
-	networkConfig   *network.NetworkingConfig
-	parentCtx       context.Context
-	context         context.Context
-	cancelFunc      context.CancelFunc
+	name                 string
+	jobID                string
+	runtime              string
+	visibleGPUs          map[string]int
+	containerConfig      *container.Config
+	hostConfig           *container.HostConfig
+	networkConfig        *network.NetworkingConfig
+	stdoutLimit          OutputLimit
+	stderrLimit          OutputLimit
+	fileStateRequirement StateRequirement
+	lifecycleHooks       []LifecycleHook
+	timelimit            time.Duration
+	parentCtx            context.Context
+	context              *timelimitContext
+	cancelFunc           context.CancelFunc
+	// err is the first error of the options, returned when creating the
+	// container
+	err error
 }
 
 type ContainerOption func(*ContainerOptions)
 
+// setError records an invalid option
+func (o *ContainerOptions) setError(err error) {
+	if o.err == nil {
+		o.err = err
+	}
+}
+
 var (
 	DefaultContainerEnv = map[string]string{
 		"CI":              "rai",
@@ -67,6 +86,17 @@ func getEnv() []string {
 	return env
 }
 
+// privilegedWarning is logged the first time a privileged container is
+// configured without a security profile
+var privilegedWarning sync.Once
+
+// NewContainerOptions returns the options of a container configured by the
+// docker section of the configuration, followed by the given options.
+//
+// WARNING: unless docker.security_profile is set, the containers are
+// privileged. They can access every device of the host, and the dropped
+// capabilities are not enforced. Set a security profile, or use the
+// SecurityPreset or SecurityProfile options, to run untrusted code.
 func NewContainerOptions(c *Client, opts ...ContainerOption) *ContainerOptions {
 	containerConfig := &container.Config{
 		Hostname: fmt.Sprintf("%s-run-%s", config.App.Name, uuid.NewV4()),
@@ -87,7 +117,7 @@ func NewContainerOptions(c *Client, opts ...ContainerOption) *ContainerOptions {
 		Tty:             true,
 		NetworkDisabled: true,
 		WorkingDir:      "/build",
-		StopSignal:      "SIGKILL",
+		StopSignal:      Config.StopSignal,
 		Volumes:         map[string]struct{}{},
 	}
 	hostConfig := &container.HostConfig{
@@ -117,19 +147,31 @@ func NewContainerOptions(c *Client, opts ...ContainerOption) *ContainerOptions {
 			"setfcap",
 		},
 	}
+	applyResourceDefaults(hostConfig)
 	networkConfig := &network.NetworkingConfig{}
-	ctx, cancelFunc := context.WithTimeout(c.options.context, Config.TimeLimit)
+	ctx, cancelFunc := withTimelimit(c.options.context, Config.TimeLimit)
 	res := &ContainerOptions{
 		containerConfig: containerConfig,
 		hostConfig:      hostConfig,
 		networkConfig:   networkConfig,
+		timelimit:       Config.TimeLimit,
 		parentCtx:       c.options.context,
 		context:         ctx,
 		cancelFunc:      cancelFunc,
 	}
+	// the default options are privileged, a security profile makes the
+	// dropped capabilities effective
+	if Config.SecurityProfile != "" {
+		SecurityPreset(Config.SecurityProfile)(res)
+	}
 	for _, o := range opts {
 		o(res)
 	}
+	if res.hostConfig.Privileged && Config.SecurityProfile == "" {
+		privilegedWarning.Do(func() {
+			log.Warn("Containers are privileged since docker.security_profile is not set")
+		})
+	}
 	return res
 }
 
@@ -216,33 +258,179 @@ func Cmd(s []string) ContainerOption {
 	}
 }
 
+// StopSignal sets the signal sent to the container's main process when the
+// container is stopped.
+func StopSignal(sig string) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.containerConfig.StopSignal = sig
+	}
+}
+
 func Timelimit(t time.Duration) ContainerOption {
 	return func(o *ContainerOptions) {
+		o.timelimit = t
 		o.cancelFunc()
-		ctx, cancelFunc := context.WithTimeout(o.parentCtx, t)
+		ctx, cancelFunc := withTimelimit(o.parentCtx, t)
 		o.context = ctx
 		o.cancelFunc = cancelFunc
 	}
 }
 
+// ContainerContext derives the context of the container from ctx instead of
+// the client's context. The time limit of the container still applies.
+func ContainerContext(ctx context.Context) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.parentCtx = ctx
+		Timelimit(o.timelimit)(o)
+	}
+}
+
+// ContainerConfig replaces the whole container configuration, see
+// MergeContainerConfig to only set some of its fields.
 func ContainerConfig(h container.Config) ContainerOption {
 	return func(o *ContainerOptions) {
 		*o.containerConfig = h
 	}
 }
 
+// HostConfig replaces the whole host configuration, including the dropped
+// capabilities and the resource limits, see MergeHostConfig to only set some
+// of its fields.
 func HostConfig(h container.HostConfig) ContainerOption {
 	return func(o *ContainerOptions) {
 		*o.hostConfig = h
 	}
 }
 
+// NetworkConfig replaces the whole network configuration, see
+// MergeNetworkConfig to only add endpoints.
 func NetworkConfig(h network.NetworkingConfig) ContainerOption {
 	return func(o *ContainerOptions) {
 		*o.networkConfig = h
 	}
 }
 
+// MergeContainerConfig merges h into the container configuration. The
+// non-zero scalars of h override the current values, slices are appended to
+// and maps are merged. The environment is merged by variable name and the
+// command, entrypoint and shell of h replace the current ones.
+func MergeContainerConfig(h container.Config) ContainerOption {
+	return func(o *ContainerOptions) {
+		env := mergeEnv(o.containerConfig.Env, h.Env)
+		cmd, entrypoint, shell := o.containerConfig.Cmd, o.containerConfig.Entrypoint, o.containerConfig.Shell
+		h.Env = nil
+		if err := mergo.Merge(o.containerConfig, h, mergo.WithOverride, mergo.WithAppendSlice); err != nil {
+			log.WithError(err).Error("failed to merge the container configuration")
+			return
+		}
+		o.containerConfig.Env = env
+		if len(h.Cmd) == 0 {
+			o.containerConfig.Cmd = cmd
+		} else {
+			o.containerConfig.Cmd = h.Cmd
+		}
+		if len(h.Entrypoint) == 0 {
+			o.containerConfig.Entrypoint = entrypoint
+		} else {
+			o.containerConfig.Entrypoint = h.Entrypoint
+		}
+		if len(h.Shell) == 0 {
+			o.containerConfig.Shell = shell
+		} else {
+			o.containerConfig.Shell = h.Shell
+		}
+	}
+}
+
+// MergeHostConfig merges h into the host configuration. The non-zero scalars
+// of h override the current values, slices such as Binds, Devices, Mounts or
+// CapDrop are appended to and maps are merged. The capabilities are added or
+// dropped once. Since false is the zero value, a false Privileged does not
+// override the privileged default; use Privileged(false) instead.
+func MergeHostConfig(h container.HostConfig) ContainerOption {
+	return func(o *ContainerOptions) {
+		if err := mergo.Merge(o.hostConfig, h, mergo.WithOverride, mergo.WithAppendSlice); err != nil {
+			log.WithError(err).Error("failed to merge the host configuration")
+		}
+		o.hostConfig.CapAdd = uniqueCapabilities(o.hostConfig.CapAdd)
+		o.hostConfig.CapDrop = uniqueCapabilities(o.hostConfig.CapDrop)
+		o.hostConfig.Ulimits = uniqueUlimits(o.hostConfig.Ulimits)
+	}
+}
+
+// uniqueUlimits keeps a single ulimit per name, the last one set taking the
+// place of the first
+func uniqueUlimits(ulimits []*units.Ulimit) []*units.Ulimit {
+	if ulimits == nil {
+		return nil
+	}
+	res := []*units.Ulimit{}
+	index := map[string]int{}
+	for _, ulimit := range ulimits {
+		if ii, ok := index[ulimit.Name]; ok {
+			res[ii] = ulimit
+			continue
+		}
+		index[ulimit.Name] = len(res)
+		res = append(res, ulimit)
+	}
+	return res
+}
+
+// uniqueCapabilities removes the repeated capabilities, which the daemon
+// accepts in any case and with or without the CAP_ prefix
+func uniqueCapabilities(caps strslice.StrSlice) strslice.StrSlice {
+	if caps == nil {
+		return nil
+	}
+	res := strslice.StrSlice{}
+	seen := map[string]bool{}
+	for _, c := range caps {
+		key := strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		res = append(res, c)
+	}
+	return res
+}
+
+// MergeNetworkConfig adds the endpoints of h to the network configuration,
+// replacing the endpoints of the same networks.
+func MergeNetworkConfig(h network.NetworkingConfig) ContainerOption {
+	return func(o *ContainerOptions) {
+		if len(h.EndpointsConfig) == 0 {
+			return
+		}
+		if o.networkConfig.EndpointsConfig == nil {
+			o.networkConfig.EndpointsConfig = map[string]*network.EndpointSettings{}
+		}
+		for name, endpoint := range h.EndpointsConfig {
+			o.networkConfig.EndpointsConfig[name] = endpoint
+		}
+	}
+}
+
+// mergeEnv returns the variables of env with the ones of overrides, which
+// take precedence. The order of the variables is preserved.
+func mergeEnv(env, overrides []string) []string {
+	res := []string{}
+	index := map[string]int{}
+	for _, list := range [][]string{env, overrides} {
+		for _, kv := range list {
+			key := strings.SplitN(kv, "=", 2)[0]
+			if ii, ok := index[key]; ok {
+				res[ii] = kv
+				continue
+			}
+			index[key] = len(res)
+			res = append(res, kv)
+		}
+	}
+	return res
+}
+
 func Hostname(h string) ContainerOption {
 	return func(o *ContainerOptions) {
 		o.containerConfig.Hostname = h
@@ -267,6 +455,15 @@ func Memory(n int64) ContainerOption {
 	}
 }
 
+// OutputLimits limits the number of bytes copied from the container's stdout
+// and stderr streams by Attach.
+func OutputLimits(stdout, stderr OutputLimit) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.stdoutLimit = stdout
+		o.stderrLimit = stderr
+	}
+}
+
 func NetworkDisabled(b bool) ContainerOption {
 	return func(o *ContainerOptions) {
 		o.containerConfig.NetworkDisabled = b
@@ -305,6 +502,13 @@ func ReadonlyRootfs(b bool) ContainerOption {
 	}
 }
 
+// Privileged sets whether the container is privileged, which it is by default
+func Privileged(b bool) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.Privileged = b
+	}
+}
+
 func Device(d container.DeviceMapping) ContainerOption {
 	return Devices([]container.DeviceMapping{d})
 }
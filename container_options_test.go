@@ -0,0 +1,386 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	units "github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContainerOptions(opts ...ContainerOption) *ContainerOptions {
+	res := &ContainerOptions{
+		containerConfig: &container.Config{},
+		hostConfig:      &container.HostConfig{},
+	}
+	for _, o := range opts {
+		o(res)
+	}
+	return res
+}
+
+func TestResourceOptions(t *testing.T) {
+	opts := testContainerOptions(
+		NanoCPUs(1500000000),
+		CpusetCpus("0-3"),
+		PidsLimit(256),
+		Ulimit("nofile", 1024, 2048),
+		Ulimit("nofile", 4096, 4096),
+		Ulimit("core", 0, 0),
+		ShmSize(64<<20),
+		MemoryReservation(1<<30),
+		MemorySwap(-1),
+		BlkioWeight(300),
+		DeviceReadBps("/dev/sda", 100<<20),
+		DeviceReadBps("/dev/sda", 50<<20),
+	)
+	r := opts.hostConfig.Resources
+	assert.Equal(t, int64(1500000000), r.NanoCPUs)
+	assert.Equal(t, "0-3", r.CpusetCpus)
+	if assert.NotNil(t, r.PidsLimit) {
+		assert.Equal(t, int64(256), *r.PidsLimit)
+	}
+	assert.Equal(t, []*units.Ulimit{
+		{Name: "nofile", Soft: 4096, Hard: 4096},
+		{Name: "core", Soft: 0, Hard: 0},
+	}, r.Ulimits)
+	assert.Equal(t, int64(64<<20), opts.hostConfig.ShmSize)
+	assert.Equal(t, int64(1<<30), r.MemoryReservation)
+	assert.Equal(t, int64(-1), r.MemorySwap)
+	assert.Equal(t, uint16(300), r.BlkioWeight)
+	assert.Equal(t, []*blkiodev.ThrottleDevice{{Path: "/dev/sda", Rate: 50 << 20}}, r.BlkioDeviceReadBps)
+}
+
+func TestResourceOptionsCopy(t *testing.T) {
+	nofile := &units.Ulimit{Name: "nofile", Soft: 1024, Hard: 1024}
+	sda := &blkiodev.ThrottleDevice{Path: "/dev/sda", Rate: 100}
+	shared := &container.HostConfig{Resources: container.Resources{
+		Ulimits:            []*units.Ulimit{nofile},
+		BlkioDeviceReadBps: []*blkiodev.ThrottleDevice{sda},
+	}}
+	opts := testContainerOptions(
+		MergeHostConfig(*shared),
+		Ulimit("nofile", 4096, 4096),
+		DeviceReadBps("/dev/sda", 200),
+	)
+	assert.Equal(t, []*units.Ulimit{{Name: "nofile", Soft: 4096, Hard: 4096}}, opts.hostConfig.Ulimits)
+	assert.Equal(t, []*blkiodev.ThrottleDevice{{Path: "/dev/sda", Rate: 200}}, opts.hostConfig.BlkioDeviceReadBps)
+
+	// the configuration of the caller is left untouched
+	assert.Equal(t, &units.Ulimit{Name: "nofile", Soft: 1024, Hard: 1024}, nofile)
+	assert.Equal(t, []*units.Ulimit{nofile}, shared.Ulimits)
+	assert.Equal(t, uint64(100), sda.Rate)
+}
+
+func TestBlkioWeightRange(t *testing.T) {
+	for _, w := range []uint16{0, 9, 1001} {
+		opts := testContainerOptions(BlkioWeight(w))
+		assert.Error(t, opts.err, "weight %d", w)
+		assert.Equal(t, uint16(0), opts.hostConfig.BlkioWeight)
+	}
+	opts := testContainerOptions(BlkioWeight(10), BlkioWeight(1000))
+	assert.NoError(t, opts.err)
+	assert.Equal(t, uint16(1000), opts.hostConfig.BlkioWeight)
+}
+
+// captureLogs replaces the logger of the package by one recording the entries
+func captureLogs() (*test.Hook, func()) {
+	logger, hook := test.NewNullLogger()
+	prev := log
+	log = logger.WithField("pkg", "docker")
+	return hook, func() {
+		log = prev
+	}
+}
+
+func TestParseResourceConfig(t *testing.T) {
+	hook, restore := captureLogs()
+	defer restore()
+
+	bts, ok := parseBytes("shm_size", "64mb")
+	assert.True(t, ok)
+	assert.Equal(t, int64(64000000), bts)
+	bts, ok = parseBytes("memory_swap", "-1")
+	assert.True(t, ok)
+	assert.Equal(t, int64(-1), bts)
+	_, ok = parseBytes("shm_size", "")
+	assert.False(t, ok)
+	assert.Empty(t, hook.AllEntries())
+
+	_, ok = parseBytes("shm_size", "64 potatoes")
+	assert.False(t, ok)
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, "shm_size", hook.LastEntry().Data["key"])
+		assert.Equal(t, "64 potatoes", hook.LastEntry().Data["value"])
+	}
+	hook.Reset()
+
+	// the invalid ulimits are left out and logged
+	assert.Equal(t, []*units.Ulimit{
+		{Name: "core", Soft: 0, Hard: 0},
+		{Name: "nofile", Soft: 1024, Hard: 2048},
+	}, parseUlimits(map[string]string{"nofile": "1024:2048", "core": "0", "bogus": "1"}))
+	if assert.Len(t, hook.AllEntries(), 1) {
+		assert.Equal(t, "bogus", hook.LastEntry().Data["ulimit"])
+	}
+	hook.Reset()
+
+	assert.Equal(t, []*blkiodev.ThrottleDevice{{Path: "/dev/sda", Rate: 100000000}},
+		parseThrottleDevices("device_read_bps", map[string]string{
+			"/dev/sda": "100mb",
+			"/dev/sdb": "fast",
+			"/dev/sdc": "-1",
+		}))
+	assert.Len(t, hook.AllEntries(), 2)
+	hook.Reset()
+
+	assert.Equal(t, 500, parseBlkioWeight(500))
+	assert.Equal(t, 0, parseBlkioWeight(0))
+	assert.Empty(t, hook.AllEntries())
+	assert.Equal(t, 0, parseBlkioWeight(70000))
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Equal(t, "blkio_weight", hook.LastEntry().Data["key"])
+	}
+}
+
+func TestMergeHostConfig(t *testing.T) {
+	pids := int64(128)
+	device := container.DeviceMapping{PathOnHost: "/dev/nvidia0", PathInContainer: "/dev/nvidia0", CgroupPermissions: "rwm"}
+
+	// setting a single field keeps the rest of the configuration, whether
+	// the other options are applied before or after
+	for _, opts := range [][]ContainerOption{
+		{
+			Memory(1 << 30),
+			Device(device),
+			MergeHostConfig(container.HostConfig{Binds: []string{"/data:/data:ro"}, Resources: container.Resources{PidsLimit: &pids}}),
+		},
+		{
+			MergeHostConfig(container.HostConfig{Binds: []string{"/data:/data:ro"}, Resources: container.Resources{PidsLimit: &pids}}),
+			Memory(1 << 30),
+			Device(device),
+		},
+	} {
+		o := testContainerOptions(append([]ContainerOption{
+			HostConfig(container.HostConfig{CapDrop: []string{"net_raw"}}),
+		}, opts...)...)
+		h := o.hostConfig
+		assert.Equal(t, []string{"net_raw"}, []string(h.CapDrop))
+		assert.Equal(t, int64(1<<30), h.Memory)
+		assert.Equal(t, []container.DeviceMapping{device}, h.Devices)
+		assert.Equal(t, []string{"/data:/data:ro"}, h.Binds)
+		if assert.NotNil(t, h.PidsLimit) {
+			assert.Equal(t, int64(128), *h.PidsLimit)
+		}
+	}
+
+	// slices are appended to and non-zero scalars override
+	o := testContainerOptions(
+		HostConfig(container.HostConfig{Binds: []string{"/a:/a"}, ShmSize: 1, Privileged: true}),
+		MergeHostConfig(container.HostConfig{Binds: []string{"/b:/b"}, ShmSize: 2}),
+	)
+	assert.Equal(t, []string{"/a:/a", "/b:/b"}, o.hostConfig.Binds)
+	assert.Equal(t, int64(2), o.hostConfig.ShmSize)
+	assert.True(t, o.hostConfig.Privileged)
+
+	// false is the zero value, so it only overrides through Privileged
+	privileged := HostConfig(container.HostConfig{Privileged: true})
+	o = testContainerOptions(privileged, MergeHostConfig(container.HostConfig{Privileged: false, ShmSize: 2}))
+	assert.True(t, o.hostConfig.Privileged)
+	o = testContainerOptions(privileged, MergeHostConfig(container.HostConfig{ShmSize: 2}), Privileged(false))
+	assert.False(t, o.hostConfig.Privileged)
+
+	// the capabilities are not repeated
+	o = testContainerOptions(
+		HostConfig(container.HostConfig{CapAdd: []string{"sys_ptrace"}, CapDrop: []string{"net_raw", "mknod"}}),
+		MergeHostConfig(container.HostConfig{CapAdd: []string{"SYS_PTRACE"}, CapDrop: []string{"mknod", "CAP_NET_RAW", "setfcap"}}),
+	)
+	assert.Equal(t, []string{"sys_ptrace"}, []string(o.hostConfig.CapAdd))
+	assert.Equal(t, []string{"net_raw", "mknod", "setfcap"}, []string(o.hostConfig.CapDrop))
+	o = testContainerOptions(MergeHostConfig(container.HostConfig{CapDrop: []string{"net_raw"}}))
+	assert.Nil(t, o.hostConfig.CapAdd)
+
+	// nor are the ulimits, the last one set for a name wins
+	o = testContainerOptions(
+		Ulimit("nofile", 1024, 1024),
+		Ulimit("core", 0, 0),
+		MergeHostConfig(container.HostConfig{Resources: container.Resources{Ulimits: []*units.Ulimit{
+			{Name: "nproc", Soft: 64, Hard: 64},
+			{Name: "nofile", Soft: 4096, Hard: 8192},
+		}}}),
+	)
+	assert.Equal(t, []*units.Ulimit{
+		{Name: "nofile", Soft: 4096, Hard: 8192},
+		{Name: "core", Soft: 0, Hard: 0},
+		{Name: "nproc", Soft: 64, Hard: 64},
+	}, o.hostConfig.Ulimits)
+
+	// whereas HostConfig replaces everything
+	o = testContainerOptions(
+		Memory(1<<30),
+		HostConfig(container.HostConfig{ShmSize: 2}),
+	)
+	assert.Equal(t, int64(0), o.hostConfig.Memory)
+}
+
+func TestMergeContainerConfig(t *testing.T) {
+	o := testContainerOptions(
+		ContainerConfig(container.Config{
+			Image:      "ubuntu",
+			Env:        []string{"PATH=/bin", "CI=rai"},
+			Entrypoint: []string{"/bin/sh"},
+			Cmd:        []string{"-c", "true"},
+			Labels:     map[string]string{"a": "1"},
+		}),
+		AddEnv("RAI", "true"),
+		MergeContainerConfig(container.Config{
+			User:   "nobody",
+			Env:    []string{"PATH=/usr/bin:/bin", "HOME=/tmp"},
+			Cmd:    []string{"make"},
+			Labels: map[string]string{"b": "2"},
+		}),
+	)
+	c := o.containerConfig
+	assert.Equal(t, "ubuntu", c.Image)
+	assert.Equal(t, "nobody", c.User)
+	assert.Equal(t, []string{"PATH=/usr/bin:/bin", "CI=rai", "RAI=true", "HOME=/tmp"}, c.Env)
+	assert.Equal(t, []string{"/bin/sh"}, []string(c.Entrypoint))
+	assert.Equal(t, []string{"make"}, []string(c.Cmd))
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, c.Labels)
+}
+
+func TestMergeNetworkConfig(t *testing.T) {
+	o := testContainerOptions()
+	o.networkConfig = &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{"bridge": {}},
+	}
+	MergeNetworkConfig(network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{"jobs": {Aliases: []string{"job"}}},
+	})(o)
+	assert.Len(t, o.networkConfig.EndpointsConfig, 2)
+	assert.Equal(t, []string{"job"}, o.networkConfig.EndpointsConfig["jobs"].Aliases)
+}
+
+func TestSecurityProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "security")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	profile := filepath.Join(dir, "seccomp.json")
+	require.NoError(t, ioutil.WriteFile(profile, []byte("{\n  \"defaultAction\": \"SCMP_ACT_ERRNO\"\n}\n"), 0644))
+
+	opts := testContainerOptions(
+		HostConfig(container.HostConfig{
+			Privileged:  true,
+			CapDrop:     []string{"chown"},
+			SecurityOpt: []string{"seccomp=unconfined", "label:disable", "systempaths=unconfined"},
+		}),
+		SecurityProfile(SecurityConfig{
+			CapAdd:          []string{"SYS_PTRACE"},
+			CapDrop:         []string{"ALL"},
+			Seccomp:         profile,
+			AppArmorProfile: "rai-default",
+			SELinuxLabels:   []string{"type:container_t"},
+			NoNewPrivileges: true,
+			ReadonlyRootfs:  true,
+			Tmpfs:           map[string]string{"/tmp": "rw,size=64m"},
+		}),
+	)
+	h := opts.hostConfig
+	assert.False(t, h.Privileged)
+	assert.Equal(t, []string{"SYS_PTRACE"}, []string(h.CapAdd))
+	assert.Equal(t, []string{"ALL"}, []string(h.CapDrop))
+	assert.True(t, h.ReadonlyRootfs)
+	assert.Equal(t, map[string]string{"/tmp": "rw,size=64m"}, h.Tmpfs)
+	assert.Equal(t, []string{
+		"systempaths=unconfined",
+		`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`,
+		"apparmor=rai-default",
+		"label=type:container_t",
+		"no-new-privileges",
+	}, h.SecurityOpt)
+
+	// the profiles that cannot be used are errors rather than the default
+	// profile of the daemon
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0644))
+	for _, name := range []string{"missing.json", "invalid.json"} {
+		opts = testContainerOptions(SecurityProfile(SecurityConfig{Seccomp: filepath.Join(dir, name)}))
+		assert.Error(t, opts.err, name)
+	}
+}
+
+func TestSecurityPreset(t *testing.T) {
+	opts := testContainerOptions(HostConfig(container.HostConfig{Privileged: true}), SecurityPreset("trusted-build"))
+	assert.False(t, opts.hostConfig.Privileged)
+	assert.False(t, opts.hostConfig.ReadonlyRootfs)
+	assert.Empty(t, opts.hostConfig.SecurityOpt)
+
+	assert.NoError(t, opts.err)
+
+	opts = testContainerOptions(SecurityPreset("untrusted-studnet"), SecurityPreset("untrusted-student"))
+	assert.EqualError(t, opts.err, "unknown security preset untrusted-studnet")
+	assert.Equal(t, []string{"ALL"}, []string(opts.hostConfig.CapDrop))
+	assert.True(t, opts.hostConfig.ReadonlyRootfs)
+	if assert.Len(t, opts.hostConfig.SecurityOpt, 2) {
+		assert.True(t, strings.HasPrefix(opts.hostConfig.SecurityOpt[0], `seccomp={"defaultAction":"SCMP_ACT_ERRNO"`))
+		assert.Equal(t, "no-new-privileges", opts.hostConfig.SecurityOpt[1])
+	}
+
+	opts.hostConfig.CapDrop[0] = "chown"
+	assert.Equal(t, []string{"ALL"}, SecurityPresets["untrusted-student"].CapDrop)
+}
+
+func TestPrivilegedWarning(t *testing.T) {
+	d, client := newFakeDaemon(t, nil)
+	defer d.Close()
+	defer client.Close()
+	hook, restore := captureLogs()
+	defer restore()
+	privilegedWarning = sync.Once{}
+
+	for ii := 0; ii < 2; ii++ {
+		opts := NewContainerOptions(client)
+		opts.cancelFunc()
+		assert.True(t, opts.hostConfig.Privileged)
+	}
+	opts := NewContainerOptions(client, SecurityPreset("trusted-build"))
+	opts.cancelFunc()
+	assert.False(t, opts.hostConfig.Privileged)
+
+	// the warning is only logged once
+	if assert.Len(t, hook.AllEntries(), 1) {
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	}
+}
+
+func TestSeccompDefault(t *testing.T) {
+	opt, err := seccompSecurityOpt(SeccompDefault)
+	require.NoError(t, err)
+	profile := types.Seccomp{}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(opt, "seccomp=")), &profile))
+	assert.Equal(t, types.ActErrno, profile.DefaultAction)
+	assert.NotEmpty(t, profile.Syscalls)
+}
+
+func TestNewContainerInvalidSecurity(t *testing.T) {
+	d, client := newFakeDaemon(t, nil)
+	defer d.Close()
+	defer client.Close()
+
+	_, err := NewContainer(client, SecurityPreset("untrusted-studnet"))
+	assert.EqualError(t, err, "unknown security preset untrusted-studnet")
+	_, err = NewContainer(client, SecurityProfile(SecurityConfig{Seccomp: "/missing/seccomp.json"}))
+	assert.Error(t, err)
+	assert.Equal(t, 0, d.Calls("POST /containers/create"))
+}
@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitContainer(t *testing.T, routes map[string]http.HandlerFunc, opts ...ContainerOption) (*fakeDaemon, *Container, func()) {
+	d, client := newFakeDaemon(t, routes)
+	options := NewContainerOptions(client, opts...)
+	cont := &Container{ID: "c1", client: client, options: *options, state: StateRunning}
+	return d, cont, func() {
+		options.cancelFunc()
+		client.Close()
+		d.Close()
+	}
+}
+
+// blockWait blocks the wait request until the client goes away
+func blockWait(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	<-r.Context().Done()
+}
+
+func TestContainerWait(t *testing.T) {
+	finishedAt := time.Date(2019, 3, 22, 6, 55, 0, 0, time.UTC)
+	d, cont, cleanup := waitContainer(t, map[string]http.HandlerFunc{
+		"POST /containers/c1/wait": writeJSON(container.ContainerWaitOKBody{StatusCode: 137}),
+		"GET /containers/c1/json": writeJSON(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID: "c1",
+				State: &types.ContainerState{
+					Status:     "exited",
+					ExitCode:   137,
+					OOMKilled:  true,
+					FinishedAt: finishedAt.Format(time.RFC3339Nano),
+				},
+			},
+		}),
+	})
+	defer cleanup()
+
+	res, err := cont.Wait(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, WaitResult{ExitCode: 137, OOMKilled: true, FinishedAt: finishedAt}, res)
+	assert.Equal(t, 1, d.Calls("POST /containers/c1/wait"))
+}
+
+func TestContainerWaitRemoved(t *testing.T) {
+	_, cont, cleanup := waitContainer(t, map[string]http.HandlerFunc{
+		"POST /containers/c1/wait": writeJSON(container.ContainerWaitOKBody{StatusCode: 2}),
+	})
+	defer cleanup()
+
+	// the container is gone once it has been removed
+	res, err := cont.Wait(context.Background(), container.WaitConditionRemoved)
+	require.NoError(t, err)
+	assert.Equal(t, WaitResult{ExitCode: 2}, res)
+}
+
+func TestContainerWaitNotFound(t *testing.T) {
+	_, cont, cleanup := waitContainer(t, map[string]http.HandlerFunc{})
+	defer cleanup()
+
+	_, err := cont.Wait(context.Background(), "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to wait for container c1")
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestContainerWaitCancel(t *testing.T) {
+	_, cont, cleanup := waitContainer(t, map[string]http.HandlerFunc{
+		"POST /containers/c1/wait": blockWait,
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := cont.Wait(ctx, "")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestContainerWaitTimelimit(t *testing.T) {
+	_, cont, cleanup := waitContainer(t, map[string]http.HandlerFunc{
+		"POST /containers/c1/wait": blockWait,
+	}, Timelimit(50*time.Millisecond))
+	defer cleanup()
+
+	_, err := cont.Wait(context.Background(), "")
+	assert.Equal(t, ErrTimelimitExceeded, err)
+}
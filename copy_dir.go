@@ -0,0 +1,548 @@
+package docker
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SymlinkPolicy controls how symbolic links are copied
+type SymlinkPolicy int
+
+const (
+	// SymlinkPreserve copies links as links. When extracting, links that
+	// point outside of the destination directory are rejected.
+	SymlinkPreserve SymlinkPolicy = iota
+	// SymlinkFollow copies the target of the links. It only applies to the
+	// host side of CopyDirTo, CopyDirFrom preserves the links instead.
+	SymlinkFollow
+	// SymlinkSkip ignores links
+	SymlinkSkip
+)
+
+type CopyOptions struct {
+	include      []string
+	exclude      []string
+	uid          *int
+	gid          *int
+	uidMap       map[int]int
+	gidMap       map[int]int
+	symlinks     SymlinkPolicy
+	preserveMode bool
+}
+
+type CopyOption func(*CopyOptions)
+
+// CopyInclude only copies the files matching one of the glob patterns.
+// Patterns containing a slash are matched against the path relative to the
+// copied directory, the other patterns against the base name.
+func CopyInclude(patterns ...string) CopyOption {
+	return func(o *CopyOptions) {
+		o.include = append(o.include, patterns...)
+	}
+}
+
+// CopyExclude does not copy the files and directories matching one of the
+// glob patterns. Excluding a directory excludes its content.
+func CopyExclude(patterns ...string) CopyOption {
+	return func(o *CopyOptions) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// CopyChown sets the owner of every copied file
+func CopyChown(uid, gid int) CopyOption {
+	return func(o *CopyOptions) {
+		o.uid = &uid
+		o.gid = &gid
+	}
+}
+
+// CopyIDMap remaps the owners of the copied files. Ids missing from the maps
+// are kept.
+func CopyIDMap(uids, gids map[int]int) CopyOption {
+	return func(o *CopyOptions) {
+		o.uidMap = uids
+		o.gidMap = gids
+	}
+}
+
+func CopySymlinks(p SymlinkPolicy) CopyOption {
+	return func(o *CopyOptions) {
+		o.symlinks = p
+	}
+}
+
+// CopyPreserveMode controls whether the permissions of the files are kept.
+// Otherwise, files are created with 0644 and directories with 0755. It
+// defaults to true.
+func CopyPreserveMode(b bool) CopyOption {
+	return func(o *CopyOptions) {
+		o.preserveMode = b
+	}
+}
+
+func NewCopyOptions(opts ...CopyOption) *CopyOptions {
+	res := &CopyOptions{
+		symlinks:     SymlinkPreserve,
+		preserveMode: true,
+	}
+	for _, o := range opts {
+		o(res)
+	}
+	return res
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded returns true if the slash separated relative path must be skipped
+func (o *CopyOptions) excluded(rel string, isDir bool) bool {
+	if matchAny(o.exclude, rel) {
+		return true
+	}
+	return !isDir && len(o.include) != 0 && !matchAny(o.include, rel)
+}
+
+// owner returns the remapped owner of a file
+func (o *CopyOptions) owner(uid, gid int) (int, int) {
+	if o.uid != nil {
+		return *o.uid, *o.gid
+	}
+	if mapped, ok := o.uidMap[uid]; ok {
+		uid = mapped
+	}
+	if mapped, ok := o.gidMap[gid]; ok {
+		gid = mapped
+	}
+	return uid, gid
+}
+
+func (o *CopyOptions) remapsOwners() bool {
+	return o.uid != nil || o.uidMap != nil || o.gidMap != nil
+}
+
+func (o *CopyOptions) mode(mode os.FileMode) os.FileMode {
+	if o.preserveMode {
+		return mode
+	}
+	if mode.IsDir() {
+		return 0755
+	}
+	return 0644
+}
+
+// CopyDirTo copies the content of the host directory to the directory of the
+// container, which is created if it does not exist. Relative directories are
+// relative to the working directory of the container.
+func (c *Container) CopyDirTo(hostDir, containerDir string, paramOpts ...CopyOption) error {
+	opts := NewCopyOptions(paramOpts...)
+	// the missing directories are created by the daemon when extracting the
+	// archive, even if the container is not running
+	dir, prefix, err := c.existingParent(c.containerPath(containerDir))
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeDirArchive(pw, hostDir, prefix, opts))
+	}()
+	defer pr.Close()
+	return c.CopyToContainer(dir, pr)
+}
+
+// CopyDirFrom copies the file or the content of the directory of the
+// container to the host directory, which is created if it does not exist.
+func (c *Container) CopyDirFrom(containerPath, hostDir string, paramOpts ...CopyOption) error {
+	opts := NewCopyOptions(paramOpts...)
+	rc, err := c.CopyFromContainer(containerPath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return extractArchive(rc, hostDir, opts)
+}
+
+// writeDirArchive writes a tar archive of the content of dir. The paths of
+// the entries are prefixed with the slash separated prefix.
+func writeDirArchive(w io.Writer, dir, prefix string, opts *CopyOptions) error {
+	tw := tar.NewWriter(w)
+	a := &dirArchiver{
+		tw:      tw,
+		opts:    opts,
+		visited: map[string]bool{},
+		written: map[string]bool{},
+		prefix:  prefix,
+	}
+	if err := a.walk(dir, ""); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+type dirArchiver struct {
+	tw   *tar.Writer
+	opts *CopyOptions
+	// visited are the real paths of the directories being walked, used to
+	// detect loops when following links
+	visited map[string]bool
+	// written are the directories added to the archive
+	written map[string]bool
+	prefix  string
+}
+
+func (a *dirArchiver) walk(dir, rel string) error {
+	realPath, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	if a.visited[realPath] {
+		return errors.Errorf("symbolic link loop at %v", dir)
+	}
+	a.visited[realPath] = true
+	defer delete(a.visited, realPath)
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	infos, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		hostPath := filepath.Join(dir, info.Name())
+		entryRel := path.Join(rel, info.Name())
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			switch a.opts.symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkFollow:
+				if info, err = os.Stat(hostPath); err != nil {
+					return err
+				}
+			default:
+				if link, err = os.Readlink(hostPath); err != nil {
+					return err
+				}
+			}
+		}
+		if a.opts.excluded(entryRel, info.IsDir()) {
+			continue
+		}
+		if info.IsDir() {
+			if len(a.opts.include) == 0 {
+				if err := a.writeDir(entryRel, info); err != nil {
+					return err
+				}
+			}
+			if err := a.walk(hostPath, entryRel); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() && link == "" {
+			// devices, sockets and pipes are not copied
+			continue
+		}
+		if err := a.writeParents(dir, entryRel); err != nil {
+			return err
+		}
+		if err := a.writeFile(hostPath, entryRel, info, link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeParents adds the missing parent directories of the entry, which is
+// needed when only some files are included
+func (a *dirArchiver) writeParents(dir, rel string) error {
+	parent := path.Dir(rel)
+	if parent == "." || a.written[parent] {
+		return nil
+	}
+	if err := a.writeParents(filepath.Dir(dir), parent); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	return a.writeDir(parent, info)
+}
+
+func (a *dirArchiver) writeDir(rel string, info os.FileInfo) error {
+	if a.written[rel] {
+		return nil
+	}
+	a.written[rel] = true
+	hdr, err := a.header(info, rel+"/", "")
+	if err != nil {
+		return err
+	}
+	return a.tw.WriteHeader(hdr)
+}
+
+func (a *dirArchiver) writeFile(hostPath, rel string, info os.FileInfo, link string) error {
+	hdr, err := a.header(info, rel, link)
+	if err != nil {
+		return err
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if link != "" {
+		return nil
+	}
+	f, err := os.Open(hostPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(a.tw, f)
+	return err
+}
+
+func (a *dirArchiver) header(info os.FileInfo, name, link string) (*tar.Header, error) {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = path.Join(a.prefix, name)
+	if strings.HasSuffix(name, "/") {
+		hdr.Name += "/"
+	}
+	hdr.Mode = int64(a.opts.mode(info.Mode()).Perm())
+	hdr.Uid, hdr.Gid = a.opts.owner(hdr.Uid, hdr.Gid)
+	if a.opts.remapsOwners() {
+		hdr.Uname, hdr.Gname = "", ""
+	}
+	return hdr, nil
+}
+
+// extractArchive extracts an archive produced by the daemon into dir. The
+// first component of the paths, which is the name of the copied file or
+// directory, is removed. Entries that would be written outside of dir are
+// rejected.
+func extractArchive(r io.Reader, dir string, opts *CopyOptions) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	type dirMode struct {
+		path string
+		hdr  *tar.Header
+	}
+	dirs := []dirMode{}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "failed to read archive")
+		}
+
+		name := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Name), "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return errors.Errorf("archive entry %v is outside of the destination", hdr.Name)
+		}
+		rel := ""
+		if idx := strings.Index(name, "/"); idx >= 0 {
+			rel = name[idx+1:]
+		} else if hdr.Typeflag != tar.TypeDir {
+			// the copied path is a file
+			rel = name
+		}
+		if rel == "" || rel == "." {
+			continue
+		}
+		if opts.excluded(rel, hdr.Typeflag == tar.TypeDir) {
+			continue
+		}
+
+		// the entry is created in its parent as resolved on disk, so that the
+		// links extracted before cannot redirect it
+		parent, err := resolveInside(root, path.Dir(rel))
+		if err != nil {
+			return errors.Wrapf(err, "archive entry %v", hdr.Name)
+		}
+		target := filepath.Join(parent, path.Base(rel))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				return errors.Errorf("archive entry %v is a symbolic link", hdr.Name)
+			}
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMode{path: target, hdr: hdr})
+			continue
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			// do not write through an existing link
+			os.Remove(target)
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return errors.Wrapf(err, "failed to extract %v", hdr.Name)
+			}
+		case tar.TypeSymlink:
+			if opts.symlinks == SymlinkSkip {
+				continue
+			}
+			linkName := filepath.ToSlash(hdr.Linkname)
+			if path.IsAbs(linkName) {
+				return errors.Errorf("symbolic link %v points outside of the destination", hdr.Name)
+			}
+			if _, err := resolveInside(root, path.Dir(rel)+"/"+linkName); err != nil {
+				return errors.Wrapf(err, "symbolic link %v", hdr.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			linkName := path.Clean(strings.TrimPrefix(filepath.ToSlash(hdr.Linkname), "/"))
+			if idx := strings.Index(linkName, "/"); idx >= 0 {
+				linkName = linkName[idx+1:]
+			}
+			source, err := resolveInside(root, linkName)
+			if err != nil {
+				return errors.Wrapf(err, "hard link %v", hdr.Name)
+			}
+			os.Remove(target)
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+			continue
+		default:
+			// devices, sockets and pipes are not extracted
+			continue
+		}
+
+		if err := applyHeader(target, hdr, opts); err != nil {
+			return err
+		}
+	}
+
+	// the directories are updated last since their permissions may prevent
+	// their content from being written
+	for ii := len(dirs) - 1; ii >= 0; ii-- {
+		if err := applyHeader(dirs[ii].path, dirs[ii].hdr, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyHeader(target string, hdr *tar.Header, opts *CopyOptions) error {
+	info := hdr.FileInfo()
+	if opts.remapsOwners() {
+		uid, gid := opts.owner(hdr.Uid, hdr.Gid)
+		if err := os.Lchown(target, uid, gid); err != nil {
+			return errors.Wrapf(err, "failed to change the owner of %v", target)
+		}
+	}
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	// a later entry may have replaced the file by a link
+	if info, err := os.Lstat(target); err != nil {
+		return err
+	} else if info.Mode()&os.ModeSymlink != 0 {
+		return errors.Errorf("%v was replaced by a symbolic link", target)
+	}
+	if err := os.Chmod(target, opts.mode(info.Mode())&os.ModePerm); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
+
+func isInside(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// maxLinks is the number of links followed when resolving a path
+const maxLinks = 255
+
+// resolveInside resolves the slash separated path relative to root the way
+// the kernel would, following the existing links one component at a time. An
+// error is returned if the path, or any link on the way, leads outside of
+// root. The components that do not exist yet are joined as is.
+func resolveInside(root, p string) (string, error) {
+	current := root
+	components := strings.Split(p, "/")
+	for links := 0; len(components) != 0; {
+		name := components[0]
+		components = components[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			if !isInside(root, current) {
+				return "", errors.Errorf("%v is outside of the destination", p)
+			}
+			continue
+		}
+		next := filepath.Join(current, name)
+		info, err := os.Lstat(next)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+		if links++; links > maxLinks {
+			return "", errors.Errorf("too many links in %v", p)
+		}
+		dest, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		dest = filepath.ToSlash(dest)
+		if path.IsAbs(dest) {
+			return "", errors.Errorf("%v is outside of the destination", p)
+		}
+		components = append(strings.Split(dest, "/"), components...)
+	}
+	return current, nil
+}
@@ -0,0 +1,226 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func archiveNames(t *testing.T, r io.Reader) []string {
+	names := []string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func tarArchive(t *testing.T, entries ...*tar.Header) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range entries {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(hdr.Name))
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte(hdr.Name))
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf
+}
+
+func TestWriteDirArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-copy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src", "pkg"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+	for _, name := range []string{"main.go", "src/pkg/lib.go", "src/pkg/lib.o", ".git/HEAD"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	require.NoError(t, os.Symlink("main.go", filepath.Join(dir, "link.go")))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeDirArchive(buf, dir, "", NewCopyOptions(CopyExclude(".git", "*.o"))))
+	assert.Equal(t, []string{"link.go", "main.go", "src/", "src/pkg/", "src/pkg/lib.go"}, archiveNames(t, buf))
+
+	buf.Reset()
+	require.NoError(t, writeDirArchive(buf, dir, "build/in", NewCopyOptions(CopyInclude("*.go"), CopySymlinks(SymlinkSkip), CopyExclude(".git"))))
+	assert.Equal(t, []string{"build/in/main.go", "build/in/src/", "build/in/src/pkg/", "build/in/src/pkg/lib.go"}, archiveNames(t, buf))
+}
+
+func TestExtractArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-copy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	buf := tarArchive(t,
+		&tar.Header{Name: "out/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "out/run.sh", Typeflag: tar.TypeReg, Mode: 0750},
+		&tar.Header{Name: "out/sub/", Typeflag: tar.TypeDir, Mode: 0700},
+		&tar.Header{Name: "out/sub/log.txt", Typeflag: tar.TypeReg, Mode: 0600},
+		&tar.Header{Name: "out/sub/skip.o", Typeflag: tar.TypeReg, Mode: 0600},
+		&tar.Header{Name: "out/latest", Typeflag: tar.TypeSymlink, Linkname: "sub/log.txt"},
+	)
+	require.NoError(t, extractArchive(buf, dir, NewCopyOptions(CopyExclude("*.o"))))
+
+	bts, err := ioutil.ReadFile(filepath.Join(dir, "sub", "log.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "out/sub/log.txt", string(bts))
+	_, err = os.Stat(filepath.Join(dir, "sub", "skip.o"))
+	assert.True(t, os.IsNotExist(err))
+
+	info, err := os.Stat(filepath.Join(dir, "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(dir, "sub"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(dir, "latest"))
+	require.NoError(t, err)
+	assert.Equal(t, "sub/log.txt", link)
+}
+
+func TestExtractArchiveTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-copy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "dest")
+
+	buf := tarArchive(t,
+		&tar.Header{Name: "out/../../evil", Typeflag: tar.TypeReg, Mode: 0644},
+	)
+	assert.Error(t, extractArchive(buf, dest, NewCopyOptions()))
+
+	buf = tarArchive(t,
+		&tar.Header{Name: "out/escape", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+	)
+	assert.Error(t, extractArchive(buf, dest, NewCopyOptions()))
+
+	buf = tarArchive(t,
+		&tar.Header{Name: "out/abs", Typeflag: tar.TypeSymlink, Linkname: dir},
+		&tar.Header{Name: "out/abs/evil", Typeflag: tar.TypeReg, Mode: 0644},
+	)
+	assert.Error(t, extractArchive(buf, dest, NewCopyOptions()))
+
+	// a link planted beforehand must not be written through
+	require.NoError(t, os.Symlink(dir, filepath.Join(dest, "planted")))
+	buf = tarArchive(t,
+		&tar.Header{Name: "out/planted/evil", Typeflag: tar.TypeReg, Mode: 0644},
+	)
+	assert.Error(t, extractArchive(buf, dest, NewCopyOptions()))
+
+	// the links are followed on disk rather than in the text of the path
+	victim := filepath.Join(dir, "victim")
+	require.NoError(t, os.Mkdir(victim, 0700))
+	buf = tarArchive(t,
+		&tar.Header{Name: "out/d", Typeflag: tar.TypeSymlink, Linkname: "."},
+		&tar.Header{Name: "out/e", Typeflag: tar.TypeSymlink, Linkname: "d/../victim"},
+		&tar.Header{Name: "out/e/", Typeflag: tar.TypeDir, Mode: 0777},
+	)
+	assert.Error(t, extractArchive(buf, filepath.Join(dir, "dest2"), NewCopyOptions()))
+	info, err := os.Stat(victim)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// a directory replaced by a link must not be updated through it
+	buf = tarArchive(t,
+		&tar.Header{Name: "out/sub/", Typeflag: tar.TypeDir, Mode: 0777},
+		&tar.Header{Name: "out/sub", Typeflag: tar.TypeSymlink, Linkname: "."},
+	)
+	assert.Error(t, extractArchive(buf, filepath.Join(dir, "dest3"), NewCopyOptions()))
+
+	_, err = os.Stat(filepath.Join(dir, "evil"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// extraction is an archive received by the fake daemon
+type extraction struct {
+	Path  string
+	Names []string
+}
+
+// extractingContainer returns the running container c1 whose existing
+// directories are the given ones. The archives copied to the container are
+// recorded.
+func extractingContainer(t *testing.T, dirs ...string) (*Container, func() []extraction, func()) {
+	var mu sync.Mutex
+	extractions := []extraction{}
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/c1/json": writeJSON(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", State: &types.ContainerState{Running: true}},
+		}),
+		"HEAD /containers/c1/archive": func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Query().Get("path")
+			for _, dir := range dirs {
+				if dir == p {
+					stat, _ := json.Marshal(types.ContainerPathStat{Name: filepath.Base(p), Mode: os.ModeDir | 0755})
+					w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		},
+		"PUT /containers/c1/archive": func(w http.ResponseWriter, r *http.Request) {
+			names := archiveNames(t, r.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			extractions = append(extractions, extraction{Path: r.URL.Query().Get("path"), Names: names})
+		},
+	})
+	options := NewContainerOptions(client, WorkingDirectory("/work"))
+	cont := &Container{ID: "c1", client: client, options: *options}
+	recorded := func() []extraction {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]extraction{}, extractions...)
+	}
+	return cont, recorded, func() {
+		options.cancelFunc()
+		client.Close()
+		d.Close()
+	}
+}
+
+func TestCopyDirToExtractPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-copy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("main"), 0644))
+
+	// the root may be read-only, the archive is extracted in the deepest
+	// existing directory
+	cont, extractions, cleanup := extractingContainer(t, "/", "/work", "/work/build")
+	defer cleanup()
+	require.NoError(t, cont.CopyDirTo(dir, "build/src/cmd"))
+	require.NoError(t, cont.CopyDirTo(dir, "/work/build"))
+	require.NoError(t, cont.CopyDirTo(dir, "/opt"))
+	assert.Equal(t, []extraction{
+		{Path: "/work/build", Names: []string{"src/cmd/main.go"}},
+		{Path: "/work/build", Names: []string{"main.go"}},
+		{Path: "/", Names: []string{"opt/main.go"}},
+	}, extractions())
+}
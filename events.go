@@ -0,0 +1,284 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/pkg/errors"
+)
+
+// DaemonEvents subscribes to the daemon's event stream using the given
+// filters. If the stream breaks, the subscription is re-established with an
+// exponential backoff and resumes from the last received event. The returned
+// channel is closed once the context is done.
+func (c *Client) DaemonEvents(ctx context.Context, filter filters.Args) <-chan events.Message {
+	return c.events(ctx, filter, time.Time{})
+}
+
+// events is like DaemonEvents but replays the events that happened since the given
+// time. A zero time only reports future events.
+func (c *Client) events(ctx context.Context, filter filters.Args, since time.Time) <-chan events.Message {
+	out := make(chan events.Message)
+	go func() {
+		defer close(out)
+
+		// time of the last received event, the given time is only passed on
+		// to the daemon since its clock may differ from ours
+		var lastNano int64
+		// events received at lastNano, used to drop the duplicates that are
+		// replayed when resuming
+		seen := map[string]bool{}
+
+		b := backoff.NewExponentialBackOff()
+		b.MaxElapsedTime = 0
+
+		for {
+			opts := types.EventsOptions{
+				Filters: filter,
+			}
+			if lastNano != 0 {
+				opts.Since = formatEventTime(lastNano)
+			} else if !since.IsZero() {
+				opts.Since = formatEventTime(since.UnixNano())
+			}
+			subCtx, cancel := context.WithCancel(ctx)
+			msgs, errs := c.Client.Events(subCtx, opts)
+			err := func() error {
+				for {
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case err := <-errs:
+						return err
+					case msg := <-msgs:
+						b.Reset()
+						key := msg.Type + "/" + msg.Action + "/" + msg.Actor.ID
+						if msg.TimeNano < lastNano || (msg.TimeNano == lastNano && seen[key]) {
+							continue
+						}
+						if msg.TimeNano > lastNano {
+							lastNano = msg.TimeNano
+							seen = map[string]bool{}
+						}
+						seen[key] = true
+						select {
+						case out <- msg:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+					}
+				}
+			}()
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			wait := b.NextBackOff()
+			log.WithError(err).WithField("retry_in", wait).Debug("lost the daemon event stream")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+	return out
+}
+
+func formatEventTime(nano int64) string {
+	return fmt.Sprintf("%d.%09d", nano/int64(time.Second), nano%int64(time.Second))
+}
+
+// eventHub shares a single subscription to the container events of the
+// daemon between the containers and executions of a client. The subscription
+// is opened with the first subscriber and closed with the last one.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[*eventSubscription]struct{}
+	cancel context.CancelFunc
+}
+
+type eventSubscription struct {
+	containerID string
+	actions     map[string]bool
+	mu          sync.Mutex
+	queue       []events.Message
+	ready       chan struct{}
+}
+
+func (s *eventSubscription) matches(msg events.Message) bool {
+	if msg.Actor.ID != s.containerID {
+		return false
+	}
+	return len(s.actions) == 0 || s.actions[msg.Action]
+}
+
+// push queues the message without blocking so that a slow subscriber does
+// not hold up the others
+func (s *eventSubscription) push(msg events.Message) {
+	s.mu.Lock()
+	s.queue = append(s.queue, msg)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *eventSubscription) pop() []events.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.queue
+	s.queue = nil
+	return queue
+}
+
+// containerEvents returns the events of the given actions for the container,
+// or all of its events if no action is given, until the context is done.
+// Events that happened since the shared subscription was opened may be
+// replayed to new subscribers.
+func (c *Client) containerEvents(ctx context.Context, containerID string, actions ...string) <-chan events.Message {
+	sub := &eventSubscription{
+		containerID: containerID,
+		actions:     map[string]bool{},
+		ready:       make(chan struct{}, 1),
+	}
+	for _, action := range actions {
+		sub.actions[action] = true
+	}
+
+	hub := &c.hub
+	hub.mu.Lock()
+	if hub.subs == nil {
+		hub.subs = map[*eventSubscription]struct{}{}
+	}
+	if hub.cancel == nil {
+		var hubCtx context.Context
+		hubCtx, hub.cancel = context.WithCancel(context.Background())
+		go c.runEventHub(hubCtx)
+	}
+	hub.subs[sub] = struct{}{}
+	hub.mu.Unlock()
+
+	out := make(chan events.Message)
+	go func() {
+		defer close(out)
+		defer func() {
+			hub.mu.Lock()
+			defer hub.mu.Unlock()
+			delete(hub.subs, sub)
+			if len(hub.subs) == 0 && hub.cancel != nil {
+				hub.cancel()
+				hub.cancel = nil
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sub.ready:
+			}
+			for _, msg := range sub.pop() {
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// runEventHub fans the container events of the daemon out to the
+// subscribers of the hub until the context is done.
+func (c *Client) runEventHub(ctx context.Context) {
+	filter := filters.NewArgs()
+	filter.Add("type", events.ContainerEventType)
+	// replay from the time the hub was opened so that the events are not
+	// missed while the stream is being established
+	for msg := range c.events(ctx, filter, time.Now()) {
+		c.hub.mu.Lock()
+		// a hub that was closed must not deliver to the subscribers of the
+		// one that replaced it
+		if ctx.Err() == nil {
+			for sub := range c.hub.subs {
+				if sub.matches(msg) {
+					sub.push(msg)
+				}
+			}
+		}
+		c.hub.mu.Unlock()
+	}
+}
+
+// WaitForExit blocks until the container is no longer running and returns
+// its exit code.
+func (c *Client) WaitForExit(ctx context.Context, containerID string) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// subscribe before inspecting so that the exit can not be missed
+	msgs := c.containerEvents(ctx, containerID, "die")
+
+	info, err := c.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return -1, errors.Wrapf(err, "failed to inspect container %v", containerID)
+	}
+	if info.State != nil && !info.State.Running && !info.State.Restarting {
+		return info.State.ExitCode, nil
+	}
+
+	for msg := range msgs {
+		code, err := strconv.Atoi(msg.Actor.Attributes["exitCode"])
+		if err != nil {
+			return -1, errors.Wrapf(err, "invalid exit code for container %v", containerID)
+		}
+		return code, nil
+	}
+	return -1, ctx.Err()
+}
+
+// WaitForHealthy blocks until the health check of the container reports the
+// container as healthy. An error is returned if the container has no health
+// check or if it exits.
+func (c *Client) WaitForHealthy(ctx context.Context, containerID string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	msgs := c.containerEvents(ctx, containerID)
+
+	info, err := c.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to inspect container %v", containerID)
+	}
+	if info.State == nil || info.State.Health == nil {
+		return errors.Errorf("container %v does not have a health check", containerID)
+	}
+	if info.State.Health.Status == types.Healthy {
+		return nil
+	}
+	if !info.State.Running {
+		return errors.Errorf("container %v is not running", containerID)
+	}
+
+	for msg := range msgs {
+		switch {
+		case msg.Action == "health_status: "+types.Healthy:
+			return nil
+		case msg.Action == "die":
+			return errors.Errorf("container %v exited before becoming healthy", containerID)
+		case strings.HasPrefix(msg.Action, "health_status"):
+			log.WithField("container_id", containerID).WithField("status", msg.Action).Debug("container is not healthy yet")
+		}
+	}
+	return ctx.Err()
+}
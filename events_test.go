@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func containerEvent(id, action string, nano int64) events.Message {
+	return events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		Actor:    events.Actor{ID: id},
+		TimeNano: nano,
+	}
+}
+
+func TestDaemonEventsResume(t *testing.T) {
+	var mu sync.Mutex
+	since := []string{}
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /events": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			since = append(since, r.URL.Query().Get("since"))
+			first := len(since) == 1
+			mu.Unlock()
+
+			enc := json.NewEncoder(w)
+			enc.Encode(containerEvent("c1", "start", 1e9+5))
+			enc.Encode(containerEvent("c1", "pause", 1e9+5))
+			if first {
+				// drop the stream
+				return
+			}
+			// the events at the resumed time are replayed by the daemon
+			enc.Encode(containerEvent("c1", "unpause", 1e9+5))
+			enc.Encode(containerEvent("c1", "die", 2e9))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	})
+	defer d.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs := client.DaemonEvents(ctx, filters.NewArgs())
+
+	actions := []string{}
+	for msg := range msgs {
+		actions = append(actions, msg.Action)
+		if msg.Action == "die" {
+			cancel()
+		}
+	}
+	assert.Equal(t, []string{"start", "pause", "unpause", "die"}, actions)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"", "1.000000005"}, since)
+}
+
+func TestContainerEventsShared(t *testing.T) {
+	release := make(chan struct{})
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /events": func(w http.ResponseWriter, r *http.Request) {
+			w.(http.Flusher).Flush()
+			<-release
+			enc := json.NewEncoder(w)
+			enc.Encode(containerEvent("c1", "start", 1))
+			enc.Encode(containerEvent("c2", "start", 2))
+			enc.Encode(containerEvent("c1", "die", 3))
+			enc.Encode(containerEvent("c2", "die", 4))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	})
+	defer d.Close()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c1 := client.containerEvents(ctx, "c1", "die")
+	c2 := client.containerEvents(ctx, "c2")
+	eventually(t, func() bool { return d.Calls("GET /events") == 1 })
+	close(release)
+
+	assert.Equal(t, containerEvent("c1", "die", 3), <-c1)
+	assert.Equal(t, containerEvent("c2", "start", 2), <-c2)
+	assert.Equal(t, containerEvent("c2", "die", 4), <-c2)
+	assert.Equal(t, 1, d.Calls("GET /events"))
+
+	// the subscription is closed with the last subscriber
+	cancel()
+	_, ok := <-c1
+	assert.False(t, ok)
+	_, ok = <-c2
+	assert.False(t, ok)
+	eventually(t, func() bool {
+		client.hub.mu.Lock()
+		defer client.hub.mu.Unlock()
+		return client.hub.cancel == nil
+	})
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	client.containerEvents(ctx, "c1")
+	eventually(t, func() bool { return d.Calls("GET /events") == 2 })
+	client.hub.mu.Lock()
+	defer client.hub.mu.Unlock()
+	require.Len(t, client.hub.subs, 1)
+}
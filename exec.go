@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net/http/httputil"
+	"os"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
-	"github.com/cenkalti/backoff"
 	"github.com/docker/docker/api/types"
 	shellwords "github.com/junegunn/go-shellwords"
 	"github.com/pkg/errors"
@@ -22,6 +25,10 @@ type Execution struct {
 	// Path is the path or name of the command in the container.
 	Path string
 
+	// Name identifies the execution in prefixed output. If Name is the empty
+	// string, Path is used.
+	Name string
+
 	// Arguments to the command in the container, excluding the command
 	// name as the first argument.
 	Args []string
@@ -31,9 +38,26 @@ type Execution struct {
 	Env []string
 
 	// Dir specifies the working directory of the command. If Dir is the empty
-	// string, Run uses Dir specified on Method or pre-built container image.
+	// string, Run uses the working directory of the container.
 	Dir string
 
+	// User specifies the user (and optionally the group) the command runs as.
+	// If User is the empty string, Run uses the user of the container.
+	User string
+
+	// Privileged controls whether the command runs with extended privileges.
+	// If Privileged is nil, Run uses the privileged mode of the container.
+	Privileged *bool
+
+	// Tty controls whether a pseudo terminal is allocated for the command.
+	// If Tty is nil, Run uses the tty setting of the container.
+	Tty *bool
+
+	// DetachKeys overrides the key sequence used to detach from the command,
+	// for example "ctrl-p,ctrl-q". If DetachKeys is the empty string, the
+	// daemon default is used.
+	DetachKeys string
+
 	// Stdin specifies the process's standard input.
 	// If Stdin is nil, the process reads from the null device (os.DevNull).
 	//
@@ -49,14 +73,59 @@ type Execution struct {
 	Stdout io.Writer
 	Stderr io.Writer
 
+	// StdoutLimit and StderrLimit limit the number of bytes copied to Stdout
+	// and Stderr. The zero value does not limit the output.
+	StdoutLimit OutputLimit
+	StderrLimit OutputLimit
+
+	// ExitErrors makes Wait, Run and Output return an *ExitError when the
+	// command exits with a non-zero code or is killed for exceeding an output
+	// limit. By default these only return the errors of the daemon, and the
+	// exit code is reported by ExitStatus.
+	ExitErrors bool
+
 	isStarted      bool
 	execID         string
+	pidMu          sync.Mutex
+	pid            int
 	wc             chan error
+	finished       chan struct{}
 	closeAfterWait []io.Closer
+	limitWriters   []*limitWriter
+	statusMu       sync.Mutex
+	exitStatus     ExitStatus
 }
 
+// ExitStatus describes how a finished execution terminated.
+type ExitStatus struct {
+	// ExitCode is the exit code of the command
+	ExitCode int
+
+	// LimitExceeded lists the streams that exceeded their output limit
+	LimitExceeded []string
+
+	// LimitKilled is true if the command was killed because a stream
+	// exceeded a limit using the LimitKill policy
+	LimitKilled bool
+}
+
+// NewExecution creates an execution of args within the container. The execution
+// is bound to the container's context and is terminated once the container's
+// time limit is exceeded.
 func NewExecution(container *Container, args ...string) (*Execution, error) {
-	ctx := context.WithValue(container.options.context, "cmd", strings.Join(args, " "))
+	return NewExecutionContext(container.options.context, container, args...)
+}
+
+// NewExecutionContext is like NewExecution but includes a context.
+//
+// The provided context is used to terminate the process tree of the execution
+// (by calling Execution.Signal with SIGKILL) if the context becomes done before
+// the command completes on its own.
+func NewExecutionContext(ctx context.Context, container *Container, args ...string) (*Execution, error) {
+	if ctx == nil {
+		return nil, errors.New("Docker execution:: nil context")
+	}
+	ctx = context.WithValue(ctx, "cmd", strings.Join(args, " "))
 
 	var cmd string
 	var cmdArgs []string
@@ -77,12 +146,17 @@ func NewExecution(container *Container, args ...string) (*Execution, error) {
 }
 
 func NewExecutionFromString(container *Container, shell string) (*Execution, error) {
+	return NewExecutionFromStringContext(container.options.context, container, shell)
+}
+
+// NewExecutionFromStringContext is like NewExecutionFromString but includes a context.
+func NewExecutionFromStringContext(ctx context.Context, container *Container, shell string) (*Execution, error) {
 	args, err := shellwords.Parse(shell)
 	if err != nil {
 		log.WithError(err).WithField("cmd", shell).Error("Failed to parse command line")
 		return nil, errors.Wrapf(err, "Docker execution:: failed to parse command line %v", shell)
 	}
-	return NewExecution(container, args...)
+	return NewExecutionContext(ctx, container, args...)
 }
 
 func (e *Execution) CombinedOutput() ([]byte, error) {
@@ -136,18 +210,30 @@ func (e *Execution) Start() error {
 	//	e.Stdin = client.options.stdin
 	//}
 	if e.Stdout == nil {
-		e.Stdout = client.options.stdout
+		e.Stdout = e.defaultOutput(StdoutStream, client.options.stdout)
 	}
 	if e.Stderr == nil {
-		e.Stderr = client.options.stderr
+		e.Stderr = e.defaultOutput(StderrStream, client.options.stderr)
 	}
-	isTty := container.options.containerConfig.Tty
+	isTty := e.isTty()
+
+	stdout, stderr := e.limitOutput()
 
 	env := e.Env
 	if len(env) == 0 {
 		env = container.options.containerConfig.Env
 	}
 
+	user := e.User
+	if user == "" {
+		user = container.options.containerConfig.User
+	}
+
+	privileged := container.options.hostConfig.Privileged
+	if e.Privileged != nil {
+		privileged = *e.Privileged
+	}
+
 	cmd := append([]string{e.Path}, e.Args...)
 	execOpts := types.ExecConfig{
 		AttachStdin:  e.Stdin != nil,
@@ -156,9 +242,11 @@ func (e *Execution) Start() error {
 		Detach:       true,
 		Tty:          isTty,
 		Cmd:          cmd,
-		User:         container.options.containerConfig.User,
-		Privileged:   container.options.hostConfig.Privileged,
+		User:         user,
+		Privileged:   privileged,
 		Env:          env,
+		WorkingDir:   e.Dir,
+		DetachKeys:   e.DetachKeys,
 	}
 	execID, err := client.ContainerExecCreate(
 		e.context,
@@ -190,18 +278,23 @@ func (e *Execution) Start() error {
 
 	strm := &stream{
 		stdin:  e.Stdin,
-		stdout: e.Stdout,
-		stderr: e.Stderr,
+		stdout: stdout,
+		stderr: stderr,
 	}
+	e.finished = make(chan struct{})
+	// the output limits may signal the execution as soon as the streams are
+	// copied
+	e.isStarted = true
 	cErr := promise.Go(func() error {
+		defer close(e.finished)
 		defer resp.Close()
 		errHijack := holdHijackedConnection(
 			e.context,
 			strm,
 			isTty,
 			e.Stdin,
-			e.Stdout,
-			e.Stderr,
+			stdout,
+			stderr,
 			resp,
 		)
 		if errHijack == nil {
@@ -211,11 +304,151 @@ func (e *Execution) Start() error {
 	})
 
 	e.wc = cErr
-	e.isStarted = true
+	container.emit(LifecycleEvent{Type: ExecStarted, ExecID: e.execID})
+
+	go e.killOnCancel()
 
 	return err
 }
 
+// killOnCancel terminates the process tree of the execution if the
+// execution's context is done before the command finishes. Like Signal, this
+// only works when the daemon runs on the same host and the processes of the
+// container can be signaled by the current user, which usually requires root.
+func (e *Execution) killOnCancel() {
+	select {
+	case <-e.finished:
+		return
+	case <-e.context.Done():
+	}
+	if err := e.Signal(syscall.SIGKILL); err != nil {
+		log.WithError(err).
+			WithField("exec_id", e.execID).
+			Warn("failed to kill canceled execution")
+	}
+}
+
+// Signal sends a signal to the process started by the execution as well as
+// all of its descendants.
+//
+// The process id is tracked using the exec inspect endpoint of the daemon, and
+// is therefore only meaningful when the daemon runs on the same host. An error
+// is returned for remote daemons, since the pid could designate an unrelated
+// process of this host.
+func (e *Execution) Signal(sig os.Signal) error {
+	if !e.isStarted {
+		return errors.New("Docker execution:: not started")
+	}
+	if !e.container.client.isLocalDaemon() {
+		return errors.Errorf("Docker execution:: cannot signal execution %v of the remote daemon %v",
+			e.execID, e.container.client.DaemonHost())
+	}
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return errors.Errorf("Docker execution:: unsupported signal %v", sig)
+	}
+	pid, err := e.processID()
+	if err != nil || pid == 0 {
+		return err
+	}
+	if err := signalProcessTree(pid, s); err != nil {
+		return errors.Wrapf(err, "failed to send %v to execution %v", sig, e.execID)
+	}
+	return nil
+}
+
+// processID returns the host pid of the command, or 0 if it is no longer
+// running. Signal is called concurrently by the cancellation, the output
+// limits and the signal forwarders, hence the lock.
+func (e *Execution) processID() (int, error) {
+	e.pidMu.Lock()
+	defer e.pidMu.Unlock()
+	if e.pid != 0 {
+		return e.pid, nil
+	}
+	// the execution context might already be canceled at this point
+	info, err := e.container.client.ContainerExecInspect(context.Background(), e.execID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to inspect execution %v", e.execID)
+	}
+	if !info.Running {
+		return 0, nil
+	}
+	e.pid = info.Pid
+	return e.pid, nil
+}
+
+// defaultOutput returns the client's stream, wrapped in a line writer if the
+// client is configured to use line output.
+func (e *Execution) defaultOutput(stream string, out *OutStream) io.Writer {
+	if out == nil {
+		// a nil *OutStream in the interface would not compare equal to nil
+		return nil
+	}
+	name := e.Name
+	if name == "" {
+		name = e.Path
+	}
+	w := e.container.client.options.lineWriter(out, LinePrefix{
+		ContainerID: e.container.ID,
+		Name:        name,
+		Stream:      stream,
+	})
+	if w == nil {
+		return out
+	}
+	e.closeAfterWait = append(e.closeAfterWait, w)
+	return w
+}
+
+// limitOutput wraps the output writers of the execution according to the
+// configured output limits.
+func (e *Execution) limitOutput() (io.Writer, io.Writer) {
+	e.limitWriters = nil
+	e.exitStatus = ExitStatus{}
+
+	wrap := func(stream string, out io.Writer, limit OutputLimit) io.Writer {
+		if limit.IsZero() || out == nil {
+			return out
+		}
+		w := newLimitWriter(stream, out, limit, func(stream string) {
+			if limit.Policy != LimitKill {
+				return
+			}
+			e.statusMu.Lock()
+			e.exitStatus.LimitKilled = true
+			e.statusMu.Unlock()
+			go func() {
+				if err := e.Signal(syscall.SIGKILL); err != nil {
+					log.WithError(err).
+						WithField("exec_id", e.execID).
+						WithField("stream", stream).
+						Error("failed to kill execution exceeding its output limit")
+				}
+			}()
+		})
+		e.limitWriters = append(e.limitWriters, w)
+		return w
+	}
+	return wrap(StdoutStream, e.Stdout, e.StdoutLimit),
+		wrap(StderrStream, e.Stderr, e.StderrLimit)
+}
+
+// ExitStatus returns the exit status of the execution. It is only
+// meaningful once Wait or Run returned.
+func (e *Execution) ExitStatus() ExitStatus {
+	e.statusMu.Lock()
+	defer e.statusMu.Unlock()
+	return e.exitStatus
+}
+
+func (e *Execution) isTty() bool {
+	if e.Tty != nil {
+		return *e.Tty
+	}
+	return e.container.options.containerConfig.Tty
+}
+
 func (e *Execution) StdinPipe() (io.WriteCloser, error) {
 	if e.Stdin != nil {
 		return nil, errors.New("Docker execution:: Stdin already set")
@@ -253,22 +486,89 @@ func (e *Execution) Wait() error {
 		return nil
 	}
 
+	err := e.waitStreams()
+	if err == nil {
+		err = e.waitExit()
+	}
+	e.finish(err)
+	return err
+}
+
+// finish reports the end of the execution to the lifecycle hooks
+func (e *Execution) finish(err error) {
+	e.container.emit(LifecycleEvent{
+		Type:     ExecFinished,
+		ExecID:   e.execID,
+		ExitCode: e.exitStatus.ExitCode,
+		Err:      err,
+	})
+}
+
+// waitStreams waits for the hijacked connection of the execution to be
+// closed, which happens when the command exits or detaches.
+func (e *Execution) waitStreams() error {
 	if err := <-e.wc; err != nil {
 		return errors.Wrap(err, "failed to wait for hijacked connection")
 	}
 
+	e.statusMu.Lock()
+	for _, w := range e.limitWriters {
+		w.Flush()
+		if w.Exceeded() {
+			e.exitStatus.LimitExceeded = append(e.exitStatus.LimitExceeded, w.stream)
+		}
+	}
+	e.statusMu.Unlock()
+
+	return e.context.Err()
+}
+
+// execInspectInterval is the interval at which a running execution is
+// inspected in case the daemon does not report exec_die events
+const execInspectInterval = 2 * time.Second
+
+// waitExit waits until the command is no longer running and records its exit
+// code. The exec is inspected whenever the daemon reports an exec_die event
+// for the container.
+func (e *Execution) waitExit() error {
 	client := e.container.client
-	inspect := func() error {
-		info, err := client.ContainerExecInspect(e.context, e.execID)
+
+	ctx, cancel := context.WithCancel(e.context)
+	defer cancel()
+
+	msgs := client.containerEvents(ctx, e.container.ID, "exec_die")
+	ticker := time.NewTicker(execInspectInterval)
+	defer ticker.Stop()
+
+	exitCode := 0
+	for {
+		info, err := client.ContainerExecInspect(ctx, e.execID)
+		if err == nil && !info.Running {
+			exitCode = info.ExitCode
+			break
+		}
+		if ctxErr := e.context.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "failed to inspect execution %v", e.execID)
+		}
+		select {
+		case <-ctx.Done():
+		case <-msgs:
+		case <-ticker.C:
 		}
-		if !info.Running {
-			return nil
+	}
+	e.statusMu.Lock()
+	defer e.statusMu.Unlock()
+	e.exitStatus.ExitCode = exitCode
+	if e.ExitErrors && (exitCode != 0 || e.exitStatus.LimitKilled) {
+		return &ExitError{
+			ExitCode:      exitCode,
+			LimitExceeded: e.exitStatus.LimitExceeded,
 		}
-		return errors.New("container is running")
 	}
-	return backoff.Retry(inspect, backoff.NewExponentialBackOff())
+	return nil
 }
 
 func closeFds(e *Execution) {
@@ -279,7 +579,8 @@ func closeFds(e *Execution) {
 	e.closeAfterWait = []io.Closer{}
 }
 
-// ExitError reports an unsuccessful exit by a command.
+// ExitError reports an unsuccessful exit by a command whose ExitErrors field
+// is set.
 type ExitError struct {
 	// ExitCode holds the non-zero exit code of the container
 	ExitCode int
@@ -288,8 +589,15 @@ type ExitError struct {
 	// if it *Cmd executed through Output() and Cmd.Stderr was not
 	// set.
 	Stderr []byte
+
+	// LimitExceeded lists the streams that exceeded their output limit
+	LimitExceeded []string
 }
 
 func (e *ExitError) Error() string {
+	if len(e.LimitExceeded) != 0 {
+		return fmt.Sprintf("Docker execution: exit status: %d (output limit exceeded on %s)",
+			e.ExitCode, strings.Join(e.LimitExceeded, ", "))
+	}
 	return fmt.Sprintf("Docker execution: exit status: %d", e.ExitCode)
 }
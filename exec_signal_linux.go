@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// signalProcessTree sends sig to the process identified by the host pid and
+// to all of its descendants. The descendants are collected before any signal
+// is delivered so that a dying parent can not hide its children from us.
+func signalProcessTree(pid int, sig syscall.Signal) error {
+	pids := append([]int{pid}, childProcesses(pid)...)
+	var firstErr error
+	for _, p := range pids {
+		err := syscall.Kill(p, sig)
+		if err == nil || err == syscall.ESRCH {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// childProcesses returns the pids of all descendants of pid by reading the
+// parent pid of every process listed in /proc.
+func childProcesses(pid int) []int {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil
+	}
+	children := map[int][]int{}
+	for _, stat := range stats {
+		bts, err := ioutil.ReadFile(stat)
+		if err != nil {
+			continue
+		}
+		// the command name is enclosed in parentheses and may contain spaces
+		s := string(bts)
+		idx := strings.LastIndex(s, ")")
+		if idx == -1 {
+			continue
+		}
+		fields := strings.Fields(s[idx+1:])
+		if len(fields) < 2 {
+			continue
+		}
+		ppid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		p, err := strconv.Atoi(filepath.Base(filepath.Dir(stat)))
+		if err != nil {
+			continue
+		}
+		children[ppid] = append(children[ppid], p)
+	}
+
+	res := []int{}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, child := range children[p] {
+			res = append(res, child)
+			queue = append(queue, child)
+		}
+	}
+	return res
+}
@@ -0,0 +1,121 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"os/exec"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// startedExecution returns an execution whose process is a sleep started on
+// the host, as the daemon reports the host pid of the command
+func startedExecution(t *testing.T, ctx context.Context) (*Execution, *exec.Cmd, *fakeDaemon, func()) {
+	cmd := exec.Command("sleep", "30")
+	require.NoError(t, cmd.Start())
+
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /exec/e1/json": writeJSON(types.ContainerExecInspect{
+			ExecID:  "e1",
+			Running: true,
+			Pid:     cmd.Process.Pid,
+		}),
+	})
+	opts := NewContainerOptions(client)
+	e := &Execution{
+		container: &Container{ID: "c1", client: client, options: *opts},
+		context:   ctx,
+		execID:    "e1",
+		isStarted: true,
+		finished:  make(chan struct{}),
+	}
+	return e, cmd, d, func() {
+		cmd.Process.Kill()
+		opts.cancelFunc()
+		client.Close()
+		d.Close()
+	}
+}
+
+func waitSignaled(t *testing.T, cmd *exec.Cmd, sig syscall.Signal) {
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		require.Error(t, err)
+		status := err.(*exec.ExitError).Sys().(syscall.WaitStatus)
+		assert.True(t, status.Signaled())
+		assert.Equal(t, sig, status.Signal())
+	case <-time.After(5 * time.Second):
+		t.Fatal("the process was not signaled")
+	}
+}
+
+func TestExecutionSignal(t *testing.T) {
+	e, cmd, d, cleanup := startedExecution(t, context.Background())
+	defer cleanup()
+
+	wg := sync.WaitGroup{}
+	for ii := 0; ii < 4; ii++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, e.Signal(syscall.SIGTERM))
+		}()
+	}
+	wg.Wait()
+	waitSignaled(t, cmd, syscall.SIGTERM)
+	assert.Equal(t, 1, d.Calls("GET /exec/e1/json"))
+
+	assert.Error(t, (&Execution{}).Signal(syscall.SIGTERM))
+}
+
+func TestExecutionKillOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e, cmd, _, cleanup := startedExecution(t, ctx)
+	defer cleanup()
+
+	done := make(chan struct{})
+	go func() {
+		e.killOnCancel()
+		close(done)
+	}()
+	cancel()
+	<-done
+	waitSignaled(t, cmd, syscall.SIGKILL)
+}
+
+func TestExecutionFinishedBeforeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e, _, d, cleanup := startedExecution(t, ctx)
+	defer cleanup()
+
+	close(e.finished)
+	e.killOnCancel()
+	cancel()
+	assert.Equal(t, 0, d.Calls("GET /exec/e1/json"))
+}
+
+func TestWebSocketKillOnDisconnect(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	wt := newWebSocketTest(t, map[string]fakeCommand{
+		"bash": {Output: "$ ", Stdin: true, Running: time.Hour, Pid: cmd.Process.Pid},
+	}, nil)
+	defer wt.cleanup()
+
+	ws := wt.dial(t, "bash")
+	var prompt []byte
+	require.NoError(t, websocket.Message.Receive(ws, &prompt))
+	ws.Close()
+	waitSignaled(t, cmd, syscall.SIGKILL)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package docker
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+func signalProcessTree(pid int, sig syscall.Signal) error {
+	return errors.New("signaling an execution is only supported on linux")
+}
@@ -2,14 +2,23 @@ package docker
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"sort"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 	"unicode"
 
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
 	"github.com/rai-project/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -33,6 +42,19 @@ func NewExecTestSuite(t *testing.T) (*ExecTestSuite, error) {
 	}, nil
 }
 
+// startContainer starts a container for the test, which is skipped if the
+// daemon is not reachable
+func (suite *ExecTestSuite) startContainer(opts ...ContainerOption) *Container {
+	t := suite.T()
+	if _, err := suite.client.Ping(context.Background()); err != nil {
+		t.Skip("the docker daemon is not reachable")
+	}
+	cont, err := NewContainer(suite.client, opts...)
+	require.NoError(t, err)
+	require.NoError(t, cont.Start())
+	return cont
+}
+
 func (suite *ExecTestSuite) TestRun() {
 	t := suite.T()
 	client := suite.client
@@ -124,6 +146,89 @@ func (suite *ExecTestSuite) TestExecutionOutput() {
 
 }
 
+func (suite *ExecTestSuite) TestCancel() {
+	t := suite.T()
+	cont := suite.startContainer()
+	defer cont.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	exec, err := NewExecutionContext(ctx, cont, "sh", "-c", "sleep 60 & sleep 60")
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = exec.Run()
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	assert.True(t, time.Since(start) < 30*time.Second)
+
+	ps, err := NewExecution(cont, "ps", "-o", "comm")
+	require.NoError(t, err)
+	out, err := ps.Output()
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "sleep")
+}
+
+func (suite *ExecTestSuite) TestSignal() {
+	t := suite.T()
+	cont := suite.startContainer()
+	defer cont.Stop()
+
+	exec, err := NewExecution(cont, "sleep", "60")
+	require.NoError(t, err)
+	require.NoError(t, exec.Start())
+	require.NoError(t, exec.Signal(syscall.SIGTERM))
+
+	require.NoError(t, exec.Wait())
+	assert.Equal(t, 128+int(syscall.SIGTERM), exec.ExitStatus().ExitCode)
+}
+
+func (suite *ExecTestSuite) TestOverrides() {
+	t := suite.T()
+	unprivileged := func(o *ContainerOptions) {
+		o.hostConfig.Privileged = false
+	}
+	cont := suite.startContainer(unprivileged)
+	defer cont.Stop()
+
+	output := func(exec *Execution) string {
+		out, err := exec.Output()
+		require.NoError(t, err)
+		return strings.TrimSpace(string(out))
+	}
+	newExec := func(args ...string) *Execution {
+		exec, err := NewExecution(cont, args...)
+		require.NoError(t, err)
+		return exec
+	}
+
+	exec := newExec("id", "-un")
+	exec.User = "nobody"
+	assert.Equal(t, "nobody", output(exec))
+
+	exec = newExec("pwd")
+	exec.Dir = "/tmp"
+	assert.Equal(t, "/tmp", output(exec))
+
+	tty := false
+	exec = newExec("sh", "-c", "test -t 1 && echo tty || echo notty")
+	exec.Tty = &tty
+	assert.Equal(t, "notty", output(exec))
+
+	capEff := "grep CapEff /proc/self/status"
+	unprivilegedCaps := output(newExec("sh", "-c", capEff))
+	privileged := true
+	exec = newExec("sh", "-c", capEff)
+	exec.Privileged = &privileged
+	assert.NotEqual(t, unprivilegedCaps, output(exec))
+
+	exec = newExec("true")
+	exec.DetachKeys = "ctrl-x,ctrl-y"
+	assert.NoError(t, exec.Run())
+	exec = newExec("true")
+	exec.DetachKeys = "not-a-key"
+	assert.Error(t, exec.Run())
+}
+
 func TestExecutionOutput2(t *testing.T) {
 
 	config.Init()
@@ -162,6 +267,100 @@ func TestExecutionOutput2(t *testing.T) {
 
 }
 
+func TestExecutionExitStatus(t *testing.T) {
+	cont, cleanup := testScriptContainer(t, map[string]fakeCommand{
+		"make": {Output: "1 failed\n", ExitCode: 2},
+	})
+	defer cleanup()
+
+	// a failed command is not an error by default
+	exec, err := NewExecution(cont, "make")
+	require.NoError(t, err)
+	out, err := exec.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "1 failed\n", string(out))
+	assert.Equal(t, 2, exec.ExitStatus().ExitCode)
+
+	exec, err = NewExecution(cont, "make")
+	require.NoError(t, err)
+	exec.ExitErrors = true
+	_, err = exec.Output()
+	require.IsType(t, &ExitError{}, err)
+	assert.Equal(t, 2, err.(*ExitError).ExitCode)
+	assert.Equal(t, 2, exec.ExitStatus().ExitCode)
+}
+
+func TestExecutionOverrides(t *testing.T) {
+	routes := execRoutes(nil)
+	create := routes["POST /containers/c1/exec"]
+	configs := []types.ExecConfig{}
+	routes["POST /containers/c1/exec"] = func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		config := types.ExecConfig{}
+		require.NoError(t, json.Unmarshal(body, &config))
+		configs = append(configs, config)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		create(w, r)
+	}
+	d, client := newFakeDaemon(t, routes)
+	defer d.Close()
+	defer client.Close()
+	opts := NewContainerOptions(client, User("root"), Tty(true), func(o *ContainerOptions) {
+		o.containerConfig.Env = []string{"A=1"}
+		o.hostConfig.Privileged = true
+	})
+	defer opts.cancelFunc()
+	cont := &Container{ID: "c1", client: client, options: *opts}
+
+	// the container settings are used by default
+	exec, err := NewExecution(cont, "true")
+	require.NoError(t, err)
+	require.NoError(t, exec.Run())
+
+	privileged, tty := false, false
+	exec, err = NewExecution(cont, "true")
+	require.NoError(t, err)
+	exec.Env = []string{"B=2"}
+	exec.Dir = "/tmp"
+	exec.User = "nobody"
+	exec.Privileged = &privileged
+	exec.Tty = &tty
+	exec.DetachKeys = "ctrl-x"
+	require.NoError(t, exec.Run())
+
+	require.Len(t, configs, 2)
+	assert.Equal(t, []string{"A=1"}, configs[0].Env)
+	assert.Equal(t, "", configs[0].WorkingDir)
+	assert.Equal(t, "root", configs[0].User)
+	assert.True(t, configs[0].Privileged)
+	assert.True(t, configs[0].Tty)
+	assert.Equal(t, "", configs[0].DetachKeys)
+
+	assert.Equal(t, []string{"B=2"}, configs[1].Env)
+	assert.Equal(t, "/tmp", configs[1].WorkingDir)
+	assert.Equal(t, "nobody", configs[1].User)
+	assert.False(t, configs[1].Privileged)
+	assert.False(t, configs[1].Tty)
+	assert.Equal(t, "ctrl-x", configs[1].DetachKeys)
+	assert.Equal(t, []string{"true"}, configs[1].Cmd)
+}
+
+func TestExecutionSignalRemoteDaemon(t *testing.T) {
+	client, err := NewClient(Host("tcp://192.0.2.1:2375"))
+	require.NoError(t, err)
+	defer client.Close()
+
+	e := &Execution{
+		container: &Container{ID: "c1", client: client},
+		execID:    "e1",
+		isStarted: true,
+	}
+	err = e.Signal(syscall.SIGKILL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "remote daemon")
+}
+
 func TestExec(t *testing.T) {
 	c, err := NewExecTestSuite(t)
 	if !assert.NoError(t, err, "Failed to create docker client") {
@@ -0,0 +1,178 @@
+package docker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDaemon serves the endpoints of the docker API needed by a test. The
+// routes are keyed by method and path without the API version, for example
+// "GET /containers/c1/json", or by a path.Match pattern such as
+// "GET /exec/*/json". The other requests get a 404.
+type fakeDaemon struct {
+	*httptest.Server
+	mu     sync.Mutex
+	routes map[string]http.HandlerFunc
+	calls  map[string]int
+}
+
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+func newFakeDaemon(t *testing.T, routes map[string]http.HandlerFunc) (*fakeDaemon, *Client) {
+	d := &fakeDaemon{
+		routes: routes,
+		calls:  map[string]int{},
+	}
+	d.Server = httptest.NewServer(http.HandlerFunc(d.serve))
+	client, err := NewClient(Host("tcp://" + strings.TrimPrefix(d.URL, "http://")))
+	require.NoError(t, err)
+	return d, client
+}
+
+func (d *fakeDaemon) serve(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+	d.mu.Lock()
+	d.calls[key]++
+	handler, ok := d.routes[key]
+	if !ok {
+		for pattern, h := range d.routes {
+			if matched, _ := path.Match(pattern, key); matched {
+				handler, ok = h, true
+				break
+			}
+		}
+	}
+	d.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"message":"not found"}`, http.StatusNotFound)
+		return
+	}
+	handler(w, r)
+}
+
+// Calls returns the number of requests received for the route
+func (d *fakeDaemon) Calls(key string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls[key]
+}
+
+func writeJSON(v interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+}
+
+// hijack upgrades the connection the way the attach and exec start endpoints
+// do and hands the raw connection to serve, which is closed afterwards
+func hijack(serve func(r *http.Request, conn net.Conn, rw *bufio.ReadWriter)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the body would be read as the input of the stream otherwise
+		io.Copy(ioutil.Discard, r.Body)
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 UPGRADED\r\n" +
+			"Content-Type: application/vnd.docker.raw-stream\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Upgrade: tcp\r\n\r\n")
+		rw.Flush()
+		serve(r, conn, rw)
+	}
+}
+
+// fakeCommand is the behavior of a command run by the fake daemon
+type fakeCommand struct {
+	Output   string
+	ExitCode int
+	Delay    time.Duration
+	// Stdin keeps the streams open until the client closes the connection,
+	// the input is written to Input
+	Stdin bool
+	Input *lockedBuffer
+	// Running is how long the command keeps running once its streams are
+	// closed
+	Running time.Duration
+	// Pid is the host pid reported while the command is running
+	Pid int
+}
+
+type fakeExec struct {
+	fakeCommand
+	closedAt time.Time
+}
+
+// execRoutes serves the exec endpoints of the container c1. The commands are
+// looked up by their command line, the unknown ones exit with 127.
+func execRoutes(commands map[string]fakeCommand) map[string]http.HandlerFunc {
+	var mu sync.Mutex
+	execs := map[string]*fakeExec{}
+	lookup := func(r *http.Request) *fakeExec {
+		mu.Lock()
+		defer mu.Unlock()
+		return execs[path.Base(path.Dir(r.URL.Path))]
+	}
+	return map[string]http.HandlerFunc{
+		"POST /containers/c1/exec": func(w http.ResponseWriter, r *http.Request) {
+			config := types.ExecConfig{}
+			json.NewDecoder(r.Body).Decode(&config)
+			cmd, ok := commands[strings.Join(config.Cmd, " ")]
+			if !ok {
+				cmd = fakeCommand{ExitCode: 127}
+			}
+			mu.Lock()
+			id := fmt.Sprintf("e%d", len(execs))
+			execs[id] = &fakeExec{fakeCommand: cmd}
+			mu.Unlock()
+			writeJSON(types.IDResponse{ID: id})(w, r)
+		},
+		"POST /exec/*/start": hijack(func(r *http.Request, conn net.Conn, rw *bufio.ReadWriter) {
+			exec := lookup(r)
+			time.Sleep(exec.Delay)
+			rw.WriteString(exec.Output)
+			rw.Flush()
+			if exec.Stdin {
+				var input io.Writer = ioutil.Discard
+				if exec.Input != nil {
+					input = exec.Input
+				}
+				io.Copy(input, rw)
+			}
+			mu.Lock()
+			exec.closedAt = time.Now()
+			mu.Unlock()
+		}),
+		"GET /exec/*/json": func(w http.ResponseWriter, r *http.Request) {
+			exec := lookup(r)
+			mu.Lock()
+			running := exec.closedAt.IsZero() || time.Since(exec.closedAt) < exec.Running
+			mu.Unlock()
+			info := types.ContainerExecInspect{
+				Running:  running,
+				ExitCode: exec.ExitCode,
+			}
+			if running {
+				info.Pid = exec.Pid
+			}
+			writeJSON(info)(w, r)
+		},
+	}
+}
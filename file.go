@@ -0,0 +1,262 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+)
+
+// ErrFileTooLarge is returned by ReadFile and Run when the content is larger
+// than the maximum size requested
+var ErrFileTooLarge = errors.New("Docker container:: file is too large")
+
+// FileInfo describes a file of a container. It implements os.FileInfo.
+type FileInfo struct {
+	name       string
+	size       int64
+	mode       os.FileMode
+	modTime    time.Time
+	linkTarget string
+}
+
+func (fi *FileInfo) Name() string       { return fi.name }
+func (fi *FileInfo) Size() int64        { return fi.size }
+func (fi *FileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *FileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *FileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi *FileInfo) Sys() interface{}   { return nil }
+
+// LinkTarget is the target of a symbolic link
+func (fi *FileInfo) LinkTarget() string { return fi.linkTarget }
+
+func headerFileInfo(hdr *tar.Header) *FileInfo {
+	return &FileInfo{
+		name:       path.Base(strings.TrimSuffix(hdr.Name, "/")),
+		size:       hdr.Size,
+		mode:       hdr.FileInfo().Mode(),
+		modTime:    hdr.ModTime,
+		linkTarget: hdr.Linkname,
+	}
+}
+
+// containerPath resolves p relative to the working directory of the container
+func (c *Container) containerPath(p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	return path.Join("/", c.options.containerConfig.WorkingDir, p)
+}
+
+// existingParent returns the deepest existing directory of the container
+// containing the directory p, along with the slash separated path of p
+// relative to it. Archives are extracted there rather than at the root so
+// that the missing directories are created without writing to the root,
+// which may be read-only.
+func (c *Container) existingParent(p string) (string, string, error) {
+	dir := p
+	for {
+		stat, err := c.client.ContainerStatPath(c.options.context, c.ID, dir)
+		if err == nil {
+			if !stat.Mode.IsDir() && stat.Mode&os.ModeSymlink == 0 {
+				return "", "", errors.Errorf("%v is not a directory", dir)
+			}
+			return dir, strings.TrimPrefix(strings.TrimPrefix(p, dir), "/"), nil
+		}
+		if !errdefs.IsNotFound(errors.Cause(err)) || dir == "/" {
+			return "", "", errors.Wrapf(err, "failed to stat %v", dir)
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// notExist converts the not found errors of the daemon to errors satisfying
+// os.IsNotExist
+func notExist(op, p string, err error) error {
+	if errdefs.IsNotFound(errors.Cause(err)) {
+		return &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+	}
+	return err
+}
+
+// Stat returns the information of the file of the container without copying
+// it. Symbolic links are not followed. The error satisfies os.IsNotExist if
+// the file does not exist.
+func (c *Container) Stat(p string) (*FileInfo, error) {
+	if err := c.checkFileState(); err != nil {
+		return nil, err
+	}
+	p = c.containerPath(p)
+	stat, err := c.client.ContainerStatPath(c.options.context, c.ID, p)
+	if err != nil {
+		return nil, notExist("stat", p, errors.Wrapf(err, "failed to stat %v", p))
+	}
+	return &FileInfo{
+		name:       stat.Name,
+		size:       stat.Size,
+		mode:       stat.Mode,
+		modTime:    stat.Mtime,
+		linkTarget: stat.LinkTarget,
+	}, nil
+}
+
+// ReadFile returns the content of the file of the container. If maxBytes is
+// positive and the file is larger, ErrFileTooLarge is returned. Symbolic
+// links are not followed.
+func (c *Container) ReadFile(p string, maxBytes int64) ([]byte, error) {
+	p = c.containerPath(p)
+	rc, err := c.CopyFromContainer(p)
+	if err != nil {
+		return nil, notExist("open", p, err)
+	}
+	defer rc.Close()
+	return readFileArchive(rc, maxBytes)
+}
+
+func readFileArchive(r io.Reader, maxBytes int64) ([]byte, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read archive")
+	}
+	if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+		return nil, errors.Errorf("%v is not a regular file", hdr.Name)
+	}
+	if maxBytes > 0 && hdr.Size > maxBytes {
+		return nil, errors.Wrapf(ErrFileTooLarge, "%v has %d bytes", hdr.Name, hdr.Size)
+	}
+	return ioutil.ReadAll(tr)
+}
+
+// WriteFile writes the data to the file of the container, creating the file
+// and its parent directories if needed.
+func (c *Container) WriteFile(p string, data []byte, mode os.FileMode) error {
+	p = c.containerPath(p)
+	// the daemon creates the missing directories when extracting the archive
+	dir, rel, err := c.existingParent(path.Dir(p))
+	if err != nil {
+		return err
+	}
+	content, err := fileArchive(path.Join(rel, path.Base(p)), data, mode)
+	if err != nil {
+		return err
+	}
+	return c.CopyToContainer(dir, content)
+}
+
+func fileArchive(name string, data []byte, mode os.FileMode) (io.Reader, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// ReadDir returns the entries of the directory of the container sorted by
+// name. Since the daemon does not list directories, the whole directory is
+// transferred.
+func (c *Container) ReadDir(p string) ([]os.FileInfo, error) {
+	p = c.containerPath(p)
+	rc, err := c.CopyFromContainer(p)
+	if err != nil {
+		return nil, notExist("open", p, err)
+	}
+	defer rc.Close()
+	return readDirArchive(rc)
+}
+
+// readDirTree returns the entries of the directory and of all of its
+// subdirectories, keyed by their container path, from a single archive of
+// the directory.
+func (c *Container) readDirTree(p string) (map[string][]os.FileInfo, error) {
+	p = c.containerPath(p)
+	rc, err := c.CopyFromContainer(p)
+	if err != nil {
+		return nil, notExist("open", p, err)
+	}
+	defer rc.Close()
+	tree, err := readTreeArchive(rc)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]os.FileInfo, len(tree))
+	for dir, infos := range tree {
+		res[path.Join(p, dir)] = infos
+	}
+	return res, nil
+}
+
+// readDirArchive returns the direct children of the directory at the root of
+// the archive
+func readDirArchive(r io.Reader) ([]os.FileInfo, error) {
+	tree, err := readTreeArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	return tree["."], nil
+}
+
+// readTreeArchive returns the children of the directories of the archive
+// sorted by name and keyed by their path relative to the directory at the
+// root of the archive, which is ".". The contents of the files are skipped.
+func readTreeArchive(r io.Reader) (map[string][]os.FileInfo, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read archive")
+	}
+	if hdr.Typeflag != tar.TypeDir {
+		return nil, errors.Errorf("%v is not a directory", hdr.Name)
+	}
+	root := strings.TrimSuffix(hdr.Name, "/") + "/"
+	tree := map[string][]os.FileInfo{".": {}}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read archive")
+		}
+		if !strings.HasPrefix(hdr.Name, root) {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, root))
+		if name == "." {
+			continue
+		}
+		dir := path.Dir(name)
+		tree[dir] = append(tree[dir], headerFileInfo(hdr))
+		if hdr.Typeflag == tar.TypeDir && tree[name] == nil {
+			tree[name] = []os.FileInfo{}
+		}
+	}
+	for _, infos := range tree {
+		sort.Slice(infos, func(ii, jj int) bool {
+			return infos[ii].Name() < infos[jj].Name()
+		})
+	}
+	return tree, nil
+}
@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileArchive(t *testing.T) {
+	content, err := fileArchive("build/result.json", []byte(`{"ok":true}`), 0640)
+	require.NoError(t, err)
+
+	tr := tar.NewReader(content)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "build/result.json", hdr.Name)
+	assert.Equal(t, int64(0640), hdr.Mode)
+	bts, err := ioutil.ReadAll(tr)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok":true}`, string(bts))
+}
+
+func TestReadFileArchive(t *testing.T) {
+	buf := tarArchive(t, &tar.Header{Name: "result.json", Typeflag: tar.TypeReg, Mode: 0644})
+	bts, err := readFileArchive(buf, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "result.json", string(bts))
+
+	buf = tarArchive(t, &tar.Header{Name: "result.json", Typeflag: tar.TypeReg, Mode: 0644})
+	_, err = readFileArchive(buf, 4)
+	assert.Equal(t, ErrFileTooLarge, errors.Cause(err))
+
+	buf = tarArchive(t, &tar.Header{Name: "build/", Typeflag: tar.TypeDir, Mode: 0755})
+	_, err = readFileArchive(buf, 0)
+	assert.Error(t, err)
+}
+
+func TestReadDirArchive(t *testing.T) {
+	buf := tarArchive(t,
+		&tar.Header{Name: "build/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "build/b.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "build/a/", Typeflag: tar.TypeDir, Mode: 0700},
+		&tar.Header{Name: "build/a/nested.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		&tar.Header{Name: "build/c", Typeflag: tar.TypeSymlink, Linkname: "b.txt"},
+	)
+	infos, err := readDirArchive(buf)
+	require.NoError(t, err)
+	require.Len(t, infos, 3)
+
+	assert.Equal(t, "a", infos[0].Name())
+	assert.True(t, infos[0].IsDir())
+	assert.Equal(t, os.FileMode(0700), infos[0].Mode().Perm())
+
+	assert.Equal(t, "b.txt", infos[1].Name())
+	assert.Equal(t, int64(len("build/b.txt")), infos[1].Size())
+
+	assert.Equal(t, "c", infos[2].Name())
+	assert.True(t, infos[2].Mode()&os.ModeSymlink != 0)
+	assert.Equal(t, "b.txt", infos[2].(*FileInfo).LinkTarget())
+}
+
+func TestWriteFileExtractPath(t *testing.T) {
+	cont, extractions, cleanup := extractingContainer(t, "/", "/work", "/tmp")
+	defer cleanup()
+	require.NoError(t, cont.WriteFile("main.go", []byte("main"), 0644))
+	require.NoError(t, cont.WriteFile("/tmp/out/log.txt", []byte("log"), 0644))
+	assert.Equal(t, []extraction{
+		{Path: "/work", Names: []string{"main.go"}},
+		{Path: "/tmp", Names: []string{"out/log.txt"}},
+	}, extractions())
+}
@@ -9,7 +9,7 @@ import (
 )
 
 func (c *Container) CopyToContainer(targetPath string, content io.Reader) error {
-	if err := c.checkIsRunning(); err != nil {
+	if err := c.checkFileState(); err != nil {
 		return err
 	}
 	client := c.client
@@ -35,7 +35,7 @@ func (c *Container) CopyToContainer(targetPath string, content io.Reader) error
 }
 
 func (c *Container) CopyFromContainer(sourcePath string) (io.ReadCloser, error) {
-	if err := c.checkIsRunning(); err != nil {
+	if err := c.checkFileState(); err != nil {
 		return nil, err
 	}
 
@@ -59,7 +59,31 @@ func (c *Container) CopyFromContainer(sourcePath string) (io.ReadCloser, error)
 	return rc, nil
 }
 
-func (c *Container) checkIsRunning() error {
+// StateRequirement is the state a container must be in for its files to be
+// copied
+type StateRequirement int
+
+const (
+	// RequireExists allows copying files as long as the container exists,
+	// whether it was started or not
+	RequireExists StateRequirement = iota
+	// RequireRunning only allows copying files while the container is running
+	RequireRunning
+)
+
+// ErrContainerNotRunning is returned by the file operations when the
+// container is required to be running but is not.
+var ErrContainerNotRunning = errors.New("Docker container:: expecting container to be running, but was not")
+
+// RequireState sets the state the container must be in for its files to be
+// copied. It defaults to RequireExists.
+func RequireState(r StateRequirement) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.fileStateRequirement = r
+	}
+}
+
+func (c *Container) checkFileState() error {
 	client := c.client
 	info, err := client.ContainerInspect(
 		c.options.context,
@@ -70,10 +94,9 @@ func (c *Container) checkIsRunning() error {
 		log.WithError(err).WithField("container_id", c.ID).Error(msg)
 		return errors.Wrapf(err, msg+" container_id = %s", c.ID)
 	}
-	if !info.State.Running {
-		msg := "Expecting container to be running, but was not."
-		log.WithField("container_id", c.ID).Error(msg)
-		return errors.Wrapf(err, msg+" container_id = %s", c.ID)
+	if c.options.fileStateRequirement == RequireRunning && (info.State == nil || !info.State.Running) {
+		log.WithField("container_id", c.ID).Error(ErrContainerNotRunning.Error())
+		return errors.Wrapf(ErrContainerNotRunning, "container_id = %s", c.ID)
 	}
 
 	return nil
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileStateContainer returns the container c1 in the given state, whose
+// archive endpoints accept any input and return "content"
+func fileStateContainer(t *testing.T, state *types.ContainerState, opts ...ContainerOption) (*Container, *fakeDaemon, func()) {
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/c1/json": writeJSON(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", State: state},
+		}),
+		"PUT /containers/c1/archive": func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+		},
+		"GET /containers/c1/archive": func(w http.ResponseWriter, r *http.Request) {
+			stat, _ := json.Marshal(types.ContainerPathStat{Name: "output", Size: 7})
+			w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+			w.Write([]byte("content"))
+		},
+	})
+	options := NewContainerOptions(client, opts...)
+	cont := &Container{ID: "c1", client: client, options: *options}
+	return cont, d, func() {
+		options.cancelFunc()
+		client.Close()
+		d.Close()
+	}
+}
+
+func copyRoundTrip(cont *Container) error {
+	if err := cont.CopyToContainer("/tmp", strings.NewReader("input")); err != nil {
+		return err
+	}
+	rc, err := cont.CopyFromContainer("/tmp/output")
+	if err != nil {
+		return err
+	}
+	return rc.Close()
+}
+
+func TestCopyRequireExists(t *testing.T) {
+	// the inputs are staged before the container is started
+	cont, d, cleanup := fileStateContainer(t, &types.ContainerState{Status: "created"})
+	defer cleanup()
+	require.NoError(t, copyRoundTrip(cont))
+	assert.Equal(t, 1, d.Calls("PUT /containers/c1/archive"))
+	assert.Equal(t, 1, d.Calls("GET /containers/c1/archive"))
+
+	// the outputs are collected once the main process exited
+	cont, d, cleanup = fileStateContainer(t, &types.ContainerState{Status: "exited", ExitCode: 1})
+	defer cleanup()
+	require.NoError(t, copyRoundTrip(cont))
+	assert.Equal(t, 1, d.Calls("GET /containers/c1/archive"))
+}
+
+func TestCopyRequireRunning(t *testing.T) {
+	cont, d, cleanup := fileStateContainer(t, &types.ContainerState{Status: "created"}, RequireState(RequireRunning))
+	defer cleanup()
+	err := cont.CopyToContainer("/tmp", strings.NewReader("input"))
+	assert.Equal(t, ErrContainerNotRunning, errors.Cause(err))
+	_, err = cont.CopyFromContainer("/tmp/output")
+	assert.Equal(t, ErrContainerNotRunning, errors.Cause(err))
+	assert.Equal(t, 0, d.Calls("PUT /containers/c1/archive"))
+	assert.Equal(t, 0, d.Calls("GET /containers/c1/archive"))
+
+	cont, _, cleanup = fileStateContainer(t, &types.ContainerState{Status: "running", Running: true}, RequireState(RequireRunning))
+	defer cleanup()
+	assert.NoError(t, copyRoundTrip(cont))
+}
+
+func TestCopyMissingContainer(t *testing.T) {
+	d, client := newFakeDaemon(t, nil)
+	defer d.Close()
+	defer client.Close()
+	options := NewContainerOptions(client)
+	defer options.cancelFunc()
+	cont := &Container{ID: "c1", client: client, options: *options}
+
+	assert.Error(t, cont.CopyToContainer("/tmp", strings.NewReader("input")))
+	assert.Equal(t, 0, d.Calls("PUT /containers/c1/archive"))
+}
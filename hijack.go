@@ -9,6 +9,7 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/docker/pkg/term"
 	"github.com/pkg/errors"
 )
 
@@ -126,10 +127,11 @@ func holdHijackedConnection(ctx context.Context, streams Streams, tty bool,
 		}()
 	}
 
+	var stdinErr error
 	stdinDone := make(chan struct{})
 	go func() {
 		if inputStream != nil {
-			io.Copy(resp.Conn, inputStream)
+			_, stdinErr = io.Copy(resp.Conn, inputStream)
 			// we should restore the terminal as soon as possible once connection end
 			// so any following print messages will be in normal type.
 			if tty {
@@ -152,6 +154,10 @@ func holdHijackedConnection(ctx context.Context, streams Streams, tty bool,
 		}
 		return nil
 	case <-stdinDone:
+		if _, ok := stdinErr.(term.EscapeError); ok {
+			// the user typed the detach key sequence
+			return stdinErr
+		}
 		if outputStream != nil || errorStream != nil {
 			select {
 			case err := <-receiveStdout:
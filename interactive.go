@@ -0,0 +1,271 @@
+package docker
+
+import (
+	"io"
+	"os"
+	gosignal "os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/pkg/signal"
+	"github.com/docker/docker/pkg/term"
+	"github.com/pkg/errors"
+)
+
+// DefaultDetachKeys is the key sequence used to detach from an interactive
+// execution
+const DefaultDetachKeys = "ctrl-p,ctrl-q"
+
+// ErrDetached is returned by Execution.Interactive when the user detached from
+// the execution using the detach key sequence. The command keeps running in
+// the container.
+var ErrDetached = errors.New("Docker execution:: detached")
+
+// TerminalSize is the size of a terminal in characters
+type TerminalSize struct {
+	Height uint `json:"height"`
+	Width  uint `json:"width"`
+}
+
+type InteractiveOptions struct {
+	detachKeys string
+	resize     <-chan TerminalSize
+}
+
+type InteractiveOption func(*InteractiveOptions)
+
+// InteractiveDetachKeys overrides the key sequence used to detach from the
+// execution. An empty string disables detaching.
+func InteractiveDetachKeys(keys string) InteractiveOption {
+	return func(o *InteractiveOptions) {
+		o.detachKeys = keys
+	}
+}
+
+// InteractiveResize forwards the sizes received on ch to the tty of the
+// execution. It is used when the input is not a local terminal, for example
+// when the client is connected through a websocket. When the option is not
+// given and the input is a terminal, size changes of the terminal are
+// forwarded instead.
+func InteractiveResize(ch <-chan TerminalSize) InteractiveOption {
+	return func(o *InteractiveOptions) {
+		o.resize = ch
+	}
+}
+
+// Interactive runs the command with a tty attached to in and out. If in is a
+// terminal, it is put in raw mode and restored once Interactive returns. The
+// standard error of the command is written to out since the daemon merges
+// both streams when a tty is allocated.
+//
+// Interactive returns ErrDetached if the user typed the detach key sequence,
+// in which case the command keeps running in the container.
+func (e *Execution) Interactive(in io.ReadCloser, out io.Writer, paramOpts ...InteractiveOption) error {
+	if e.Stdin != nil {
+		return errors.New("Docker execution:: Stdin already set")
+	}
+	if e.Stdout != nil {
+		return errors.New("Docker execution:: Stdout already set")
+	}
+	if e.Stderr != nil {
+		return errors.New("Docker execution:: Stderr already set")
+	}
+	opts := &InteractiveOptions{
+		detachKeys: DefaultDetachKeys,
+	}
+	for _, o := range paramOpts {
+		o(opts)
+	}
+
+	defer closeFds(e)
+
+	inStream, ok := in.(*InStream)
+	if !ok {
+		inStream = NewInStream(in)
+	}
+	outStream, ok := out.(*OutStream)
+	if !ok {
+		outStream = NewOutStream(out)
+	}
+
+	if err := inStream.SetRawTerminal(); err != nil {
+		return errors.Wrap(err, "failed to set the terminal in raw mode")
+	}
+	defer inStream.RestoreTerminal()
+	if err := outStream.SetRawTerminal(); err != nil {
+		return errors.Wrap(err, "failed to set the terminal in raw mode")
+	}
+	defer outStream.RestoreTerminal()
+
+	var stdin io.Reader = inStream
+	detach := &detachReader{}
+	if opts.detachKeys != "" {
+		keys, err := term.ToBytes(opts.detachKeys)
+		if err != nil {
+			return errors.Wrapf(err, "invalid detach keys %v", opts.detachKeys)
+		}
+		detach = newDetachReader(inStream, keys)
+		stdin = detach
+		// the sequence never reaches the daemon, but its default keys would
+		// detach the execution otherwise
+		e.DetachKeys = opts.detachKeys
+	}
+
+	tty := true
+	e.Tty = &tty
+	// the terminal is managed here, hide it from the hijacked connection
+	e.Stdin = readCloser{Reader: stdin, Closer: in}
+	e.Stdout = struct{ io.Writer }{outStream}
+	e.Stderr = e.Stdout
+
+	if err := e.Start(); err != nil {
+		return err
+	}
+
+	resize := opts.resize
+	if resize == nil && inStream.IsTerminal() {
+		resize = terminalSizeEvents(inStream.FD(), e.finished)
+	}
+	if resize != nil {
+		go func() {
+			for {
+				select {
+				case <-e.finished:
+					return
+				case size, ok := <-resize:
+					if !ok {
+						return
+					}
+					resizeTty(e.container, e, size.Height, size.Width, true)
+				}
+			}
+		}()
+	}
+
+	err := e.waitStreams()
+	if detach.Detached() {
+		return ErrDetached
+	}
+	if err == nil {
+		err = e.waitExit()
+	}
+	e.finish(err)
+	return err
+}
+
+// detachReader returns a term.EscapeError once the detach key sequence is
+// read. Unlike term.NewEscapeProxy, the sequence is also detected when it is
+// read along with other input, so that it is never forwarded to the daemon.
+// The bytes matching the beginning of the sequence are withheld until the
+// sequence is complete or broken.
+type detachReader struct {
+	r        io.Reader
+	keys     []byte
+	matched  int
+	out      []byte
+	err      error
+	detached int32
+}
+
+func newDetachReader(r io.Reader, keys []byte) *detachReader {
+	return &detachReader{r: r, keys: keys}
+}
+
+func (r *detachReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.Detached() {
+			return 0, term.EscapeError{}
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		buf := make([]byte, len(p))
+		n, err := r.r.Read(buf)
+		r.scan(buf[:n])
+		if err != nil && !r.Detached() {
+			// the incomplete sequence is regular input after all
+			r.out = append(r.out, r.keys[:r.matched]...)
+			r.matched = 0
+			r.err = err
+		}
+		if n == 0 && err == nil {
+			return 0, nil
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// scan appends the input preceding the detach keys to the output
+func (r *detachReader) scan(buf []byte) {
+	for _, b := range buf {
+		if b != r.keys[r.matched] && r.matched > 0 {
+			r.out = append(r.out, r.keys[:r.matched]...)
+			r.matched = 0
+		}
+		if b != r.keys[r.matched] {
+			r.out = append(r.out, b)
+			continue
+		}
+		r.matched++
+		if r.matched == len(r.keys) {
+			// the input following the sequence is discarded
+			atomic.StoreInt32(&r.detached, 1)
+			return
+		}
+	}
+}
+
+// Detached returns true once the detach key sequence was read
+func (r *detachReader) Detached() bool {
+	return atomic.LoadInt32(&r.detached) == 1
+}
+
+// terminalSizeEvents sends the size of the terminal identified by fd and
+// every change of its size until done is closed.
+func terminalSizeEvents(fd uintptr, done <-chan struct{}) <-chan TerminalSize {
+	ch := make(chan TerminalSize, 1)
+	getTtySize := func() TerminalSize {
+		ws, err := term.GetWinsize(fd)
+		if err != nil {
+			return TerminalSize{}
+		}
+		return TerminalSize{Height: uint(ws.Height), Width: uint(ws.Width)}
+	}
+	ch <- getTtySize()
+
+	sigchan := make(chan os.Signal, 1)
+	gosignal.Notify(sigchan, signal.SIGWINCH)
+	go func() {
+		defer gosignal.Stop(sigchan)
+		// polling is required on windows where SIGWINCH does not exist
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		prev := getTtySize()
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigchan:
+			case <-ticker.C:
+			}
+			size := getTtySize()
+			if size == prev {
+				continue
+			}
+			prev = size
+			select {
+			case ch <- size:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
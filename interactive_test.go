@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/term"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInteractiveDetach(t *testing.T) {
+	cont, cleanup := testScriptContainer(t, map[string]fakeCommand{
+		"bash": {Output: "$ ", Stdin: true, Running: time.Hour},
+	})
+	defer cleanup()
+
+	exec, err := NewExecution(cont, "bash")
+	require.NoError(t, err)
+	in, w := io.Pipe()
+	go func() {
+		w.Write([]byte("ls\n"))
+		w.Write([]byte{0x10, 0x11})
+	}()
+	err = exec.Interactive(in, ioutil.Discard)
+	assert.Equal(t, ErrDetached, err)
+	w.Close()
+}
+
+func TestInteractiveWaitsForExit(t *testing.T) {
+	// the command keeps running past the 2 seconds after which it used to be
+	// reported as detached
+	cont, cleanup := testScriptContainer(t, map[string]fakeCommand{
+		"make": {Output: "done\n", ExitCode: 3, Running: 2500 * time.Millisecond},
+	})
+	defer cleanup()
+
+	exec, err := NewExecution(cont, "make")
+	require.NoError(t, err)
+	in, w := io.Pipe()
+	w.Close()
+	require.NoError(t, exec.Interactive(in, ioutil.Discard))
+	assert.Equal(t, 3, exec.ExitStatus().ExitCode)
+}
+
+func TestDetachReader(t *testing.T) {
+	keys := []byte{0x10, 0x11}
+	read := func(chunks ...string) (string, error) {
+		r, w := io.Pipe()
+		go func() {
+			for _, chunk := range chunks {
+				w.Write([]byte(chunk))
+			}
+			w.Close()
+		}()
+		detach := newDetachReader(r, keys)
+		out, err := ioutil.ReadAll(detach)
+		r.Close()
+		return string(out), err
+	}
+
+	out, err := read("ls\n\x10\x11exit\n")
+	assert.Equal(t, "ls\n", out)
+	assert.Equal(t, term.EscapeError{}, err)
+
+	out, err = read("ls\n\x10", "\x11")
+	assert.Equal(t, "ls\n", out)
+	assert.Equal(t, term.EscapeError{}, err)
+
+	out, err = read("a\x10b", "\x10\x10\x11")
+	assert.Equal(t, "a\x10b\x10", out)
+	assert.Equal(t, term.EscapeError{}, err)
+
+	out, err = read("a\x10")
+	assert.Equal(t, "a\x10", out)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,348 @@
+package docker
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	lru "github.com/flyaways/golang-lru"
+	"github.com/pkg/errors"
+)
+
+// maxSymlinkHops bounds the number of symbolic links followed when opening a
+// file
+const maxSymlinkHops = 8
+
+// containerFiles are the file operations of a container used by ContainerFS
+type containerFiles interface {
+	Stat(p string) (*FileInfo, error)
+	ReadFile(p string, maxBytes int64) ([]byte, error)
+	ReadDir(p string) ([]os.FileInfo, error)
+	readDirTree(p string) (map[string][]os.FileInfo, error)
+}
+
+type FSOptions struct {
+	cacheSize     int
+	cacheTTL      time.Duration
+	cacheMaxBytes int64
+	maxFileSize   int64
+}
+
+type FSOption func(*FSOptions)
+
+// FSCacheSize sets the number of stats, directory listings and file contents
+// kept in the cache. A size of zero disables the cache, in which case each
+// directory is listed on its own instead of listing the whole file system at
+// once.
+func FSCacheSize(n int) FSOption {
+	return func(o *FSOptions) {
+		o.cacheSize = n
+	}
+}
+
+// FSCacheTTL sets how long the cached entries are used for. It defaults to
+// 10 seconds.
+func FSCacheTTL(d time.Duration) FSOption {
+	return func(o *FSOptions) {
+		o.cacheTTL = d
+	}
+}
+
+// FSMaxFileSize rejects the files larger than n bytes when opened. Files are
+// read in memory, so the size is unlimited by default.
+func FSMaxFileSize(n int64) FSOption {
+	return func(o *FSOptions) {
+		o.maxFileSize = n
+	}
+}
+
+// ContainerFS exposes the files of a container as an fs.FS. Files are read in
+// memory when opened and symbolic links are followed.
+type ContainerFS struct {
+	files   containerFiles
+	root    string
+	options FSOptions
+	cache   *lru.Cache
+}
+
+type fsCacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// FS returns a file system rooted at the directory of the container. The
+// container does not need to be running, so the files of a job can be read
+// after it finished and until the container is removed.
+func (c *Container) FS(root string, paramOpts ...FSOption) *ContainerFS {
+	return newContainerFS(c, c.containerPath(root), paramOpts...)
+}
+
+func newContainerFS(files containerFiles, root string, paramOpts ...FSOption) *ContainerFS {
+	opts := FSOptions{
+		cacheSize:     64,
+		cacheTTL:      10 * time.Second,
+		cacheMaxBytes: 1 << 20,
+	}
+	for _, o := range paramOpts {
+		o(&opts)
+	}
+	res := &ContainerFS{
+		files:   files,
+		root:    root,
+		options: opts,
+	}
+	if opts.cacheSize > 0 {
+		res.cache, _ = lru.New(opts.cacheSize)
+	}
+	return res
+}
+
+func (cfs *ContainerFS) cached(key string, load func() (interface{}, error)) (interface{}, error) {
+	if cfs.cache == nil {
+		return load()
+	}
+	if val, ok := cfs.cache.Get(key); ok {
+		entry := val.(fsCacheEntry)
+		if time.Now().Before(entry.expires) {
+			return entry.value, nil
+		}
+		cfs.cache.Remove(key)
+	}
+	val, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if bts, ok := val.([]byte); ok && int64(len(bts)) > cfs.options.cacheMaxBytes {
+		return val, nil
+	}
+	cfs.cache.Add(key, fsCacheEntry{value: val, expires: time.Now().Add(cfs.options.cacheTTL)})
+	return val, nil
+}
+
+func (cfs *ContainerFS) stat(p string) (*FileInfo, error) {
+	val, err := cfs.cached("stat:"+p, func() (interface{}, error) {
+		return cfs.files.Stat(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.(*FileInfo), nil
+}
+
+// resolve returns the container path of the fs path with the symbolic links
+// followed, along with its information. The links are followed one component
+// at a time, and the resolved path must stay within the root, so that links
+// with absolute or .. targets do not expose the rest of the container.
+func (cfs *ContainerFS) resolve(op, name string) (string, *FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	p := cfs.root
+	var info *FileInfo
+	components := strings.Split(name, "/")
+	for hops := 0; len(components) != 0; {
+		component := components[0]
+		components = components[1:]
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			p, info = path.Dir(p), nil
+			continue
+		}
+		next := path.Join(p, component)
+		nextInfo, err := cfs.stat(next)
+		if err != nil {
+			if os.IsNotExist(err) {
+				err = fs.ErrNotExist
+			}
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		if nextInfo.Mode()&os.ModeSymlink == 0 || nextInfo.LinkTarget() == "" {
+			p, info = next, nextInfo
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+		}
+		target := nextInfo.LinkTarget()
+		if path.IsAbs(target) {
+			p, info = "/", nil
+		}
+		components = append(strings.Split(target, "/"), components...)
+	}
+	if !cfs.contains(p) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: errors.New("symbolic link leads outside of the root")}
+	}
+	if info == nil {
+		var err error
+		if info, err = cfs.stat(p); err != nil {
+			if os.IsNotExist(err) {
+				err = fs.ErrNotExist
+			}
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+	}
+	return p, info, nil
+}
+
+// contains returns true if the container path is the root or below it
+func (cfs *ContainerFS) contains(p string) bool {
+	root := path.Clean(cfs.root)
+	return root == "/" || p == root || strings.HasPrefix(p, root+"/")
+}
+
+// named returns a copy of the information with the base name of the fs path
+func named(info *FileInfo, name string) *FileInfo {
+	res := *info
+	res.name = path.Base(name)
+	return &res
+}
+
+func (cfs *ContainerFS) Open(name string) (fs.File, error) {
+	p, info, err := cfs.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info = named(info, name)
+	if info.IsDir() {
+		return &containerDir{fs: cfs, name: name, path: p, info: info}, nil
+	}
+	if cfs.options.maxFileSize > 0 && info.Size() > cfs.options.maxFileSize {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrFileTooLarge}
+	}
+	val, err := cfs.cached("file:"+p, func() (interface{}, error) {
+		return cfs.files.ReadFile(p, cfs.options.maxFileSize)
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &containerFile{Reader: bytes.NewReader(val.([]byte)), info: info}, nil
+}
+
+func (cfs *ContainerFS) Stat(name string) (fs.FileInfo, error) {
+	_, info, err := cfs.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return named(info, name), nil
+}
+
+func (cfs *ContainerFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, info, err := cfs.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	infos, err := cfs.listing(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for ii, info := range infos {
+		entries[ii] = dirEntry{info}
+	}
+	return entries, nil
+}
+
+// listing returns the entries of the directory of the container. Since the
+// daemon only lists directories by archiving them, the listings of all the
+// directories of the root are read from a single archive and cached.
+func (cfs *ContainerFS) listing(p string) ([]os.FileInfo, error) {
+	if cfs.cache != nil {
+		val, err := cfs.cached("tree:"+cfs.root, func() (interface{}, error) {
+			return cfs.files.readDirTree(cfs.root)
+		})
+		if err == nil {
+			if infos, ok := val.(map[string][]os.FileInfo)[p]; ok {
+				return infos, nil
+			}
+		}
+	}
+	// without a cache, or if the directory was created since the root was
+	// archived, the directory is listed on its own
+	val, err := cfs.cached("dir:"+p, func() (interface{}, error) {
+		return cfs.files.ReadDir(p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return val.([]os.FileInfo), nil
+}
+
+type dirEntry struct {
+	info fs.FileInfo
+}
+
+func (e dirEntry) Name() string               { return e.info.Name() }
+func (e dirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e dirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+
+// containerFile is a file read in memory. It implements io.Seeker and
+// io.ReaderAt, which http.FileServer relies on.
+type containerFile struct {
+	*bytes.Reader
+	info *FileInfo
+}
+
+func (f *containerFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *containerFile) Close() error {
+	return nil
+}
+
+// containerDir lists its entries when they are first read
+type containerDir struct {
+	fs      *ContainerFS
+	name    string
+	path    string
+	info    *FileInfo
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *containerDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *containerDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *containerDir) Close() error {
+	return nil
+}
+
+func (d *containerDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.read = true
+	}
+	if n <= 0 {
+		res := d.entries
+		d.entries = nil
+		return res, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	res := d.entries[:n]
+	d.entries = d.entries[n:]
+	return res, nil
+}
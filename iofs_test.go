@@ -0,0 +1,210 @@
+package docker
+
+import (
+	"archive/tar"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryFiles implements containerFiles over a map of contents, directories
+// being the entries ending with a slash
+type memoryFiles struct {
+	files map[string]string
+	links map[string]string
+	calls int
+}
+
+var memoryModTime = time.Date(2019, 3, 22, 0, 0, 0, 0, time.UTC)
+
+func (m *memoryFiles) info(p string) (*FileInfo, bool) {
+	if target, ok := m.links[p]; ok {
+		return &FileInfo{name: path.Base(p), mode: os.ModeSymlink | 0777, modTime: memoryModTime, linkTarget: target}, true
+	}
+	if content, ok := m.files[p]; ok {
+		return &FileInfo{name: path.Base(p), size: int64(len(content)), mode: 0644, modTime: memoryModTime}, true
+	}
+	if _, ok := m.files[p+"/"]; ok {
+		return &FileInfo{name: path.Base(p), mode: os.ModeDir | 0755, modTime: memoryModTime}, true
+	}
+	return nil, false
+}
+
+func (m *memoryFiles) Stat(p string) (*FileInfo, error) {
+	m.calls++
+	info, ok := m.info(p)
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+	}
+	return info, nil
+}
+
+func (m *memoryFiles) ReadFile(p string, maxBytes int64) ([]byte, error) {
+	m.calls++
+	return []byte(m.files[p]), nil
+}
+
+func (m *memoryFiles) ReadDir(p string) ([]os.FileInfo, error) {
+	m.calls++
+	return m.list(p), nil
+}
+
+func (m *memoryFiles) readDirTree(p string) (map[string][]os.FileInfo, error) {
+	m.calls++
+	tree := map[string][]os.FileInfo{}
+	for name := range m.files {
+		dir := strings.TrimSuffix(name, "/")
+		if strings.HasSuffix(name, "/") && (dir == p || strings.HasPrefix(dir, p+"/")) {
+			tree[dir] = m.list(dir)
+		}
+	}
+	return tree, nil
+}
+
+func (m *memoryFiles) list(p string) []os.FileInfo {
+	names := map[string]bool{}
+	for _, entries := range []map[string]string{m.files, m.links} {
+		for name := range entries {
+			if strings.HasPrefix(name, p+"/") {
+				rel := strings.TrimPrefix(name, p+"/")
+				if rel != "" {
+					names[strings.SplitN(rel, "/", 2)[0]] = true
+				}
+			}
+		}
+	}
+	infos := []os.FileInfo{}
+	for name := range names {
+		info, _ := m.info(path.Join(p, name))
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(ii, jj int) bool {
+		return infos[ii].Name() < infos[jj].Name()
+	})
+	return infos
+}
+
+func TestContainerFS(t *testing.T) {
+	files := &memoryFiles{
+		files: map[string]string{
+			"/build/":                "",
+			"/build/result.json":     `{"ok":true}`,
+			"/build/logs/":           "",
+			"/build/logs/stdout.txt": "hello",
+		},
+		links: map[string]string{
+			"/build/latest.txt": "logs/stdout.txt",
+		},
+	}
+	cfs := newContainerFS(files, "/build")
+
+	require.NoError(t, fstest.TestFS(cfs, "result.json", "logs/stdout.txt"))
+
+	bts, err := fs.ReadFile(cfs, "latest.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(bts))
+
+	_, err = cfs.Open("missing.txt")
+	assert.True(t, os.IsNotExist(err))
+	_, err = cfs.Open("../etc/passwd")
+	assert.Error(t, err)
+
+	calls := files.calls
+	_, err = fs.ReadFile(cfs, "result.json")
+	require.NoError(t, err)
+	assert.Equal(t, calls, files.calls)
+}
+
+func TestContainerFSLinks(t *testing.T) {
+	files := &memoryFiles{
+		files: map[string]string{
+			"/etc/":                  "",
+			"/etc/passwd":            "root",
+			"/build/":                "",
+			"/build/logs/":           "",
+			"/build/logs/stdout.txt": "hello",
+		},
+		links: map[string]string{
+			"/build/current": "/build/logs",
+			"/build/up":      "logs/../..",
+			"/build/passwd":  "/etc/passwd",
+			"/build/escape":  "current/../../etc",
+			"/build/loop":    "loop",
+		},
+	}
+	cfs := newContainerFS(files, "/build")
+
+	bts, err := fs.ReadFile(cfs, "current/stdout.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(bts))
+
+	// the links are confined to the root
+	for _, name := range []string{"up", "passwd", "escape/passwd", "loop"} {
+		_, err = cfs.Open(name)
+		assert.Error(t, err, name)
+		assert.False(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestContainerFSWalkDir(t *testing.T) {
+	headers := []*tar.Header{
+		{Name: "build/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "build/result.json", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "build/logs/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "build/logs/stdout.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "build/logs/old/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "build/logs/old/stdout.txt", Typeflag: tar.TypeReg, Mode: 0644},
+	}
+	stats := map[string]types.ContainerPathStat{}
+	for _, hdr := range headers {
+		name := "/" + strings.TrimSuffix(hdr.Name, "/")
+		stats[name] = types.ContainerPathStat{Name: path.Base(name), Mode: hdr.FileInfo().Mode()}
+	}
+	archive := tarArchive(t, headers...).Bytes()
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/c1/json": writeJSON(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", State: &types.ContainerState{Status: "exited"}},
+		}),
+		"HEAD /containers/c1/archive": func(w http.ResponseWriter, r *http.Request) {
+			stat, ok := stats[r.URL.Query().Get("path")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			bts, _ := json.Marshal(stat)
+			w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(bts))
+		},
+		"GET /containers/c1/archive": func(w http.ResponseWriter, r *http.Request) {
+			bts, _ := json.Marshal(stats["/build"])
+			w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(bts))
+			w.Write(archive)
+		},
+	})
+	defer d.Close()
+	defer client.Close()
+	options := NewContainerOptions(client)
+	defer options.cancelFunc()
+	cont := &Container{ID: "c1", client: client, options: *options}
+
+	names := []string{}
+	err := fs.WalkDir(cont.FS("/build"), ".", func(name string, entry fs.DirEntry, err error) error {
+		names = append(names, name)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{".", "logs", "logs/old", "logs/old/stdout.txt", "logs/stdout.txt", "result.json"}, names)
+	// the directories are listed from a single archive
+	assert.Equal(t, 1, d.Calls("GET /containers/c1/archive"))
+}
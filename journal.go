@@ -0,0 +1,317 @@
+package docker
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+	"github.com/rai-project/uuid"
+)
+
+// JournalLabel records the journal a container was created with, which
+// identifies the containers the journal owns
+const JournalLabel = "rai.docker.journal"
+
+var (
+	journalMetaBucket       = []byte("meta")
+	journalContainersBucket = []byte("containers")
+	journalIDKey            = []byte("id")
+)
+
+// JournalTransition is a state change of a journaled container
+type JournalTransition struct {
+	State ContainerState `json:"state"`
+	Time  time.Time      `json:"time"`
+}
+
+// JournalEntry is the record of a container in the journal
+type JournalEntry struct {
+	ContainerID string         `json:"container_id"`
+	JobID       string         `json:"job_id,omitempty"`
+	GPUs        map[string]int `json:"gpus,omitempty"`
+	// Deadline is when the time limit of the container expires. It is zero
+	// while the container is paused, in which case Remaining is the time
+	// left.
+	Deadline    time.Time           `json:"deadline,omitempty"`
+	Remaining   time.Duration       `json:"remaining"`
+	State       ContainerState      `json:"state"`
+	Transitions []JournalTransition `json:"transitions"`
+}
+
+// Journal persists the containers created by a client in an embedded bolt
+// database so that they can be supervised again after a restart.
+type Journal struct {
+	db *bolt.DB
+	id string
+}
+
+// OpenJournal opens the journal stored at path, creating it if needed.
+func OpenJournal(path string) (*Journal, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open journal %v", path)
+	}
+	j := &Journal{db: db}
+	err = db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(journalMetaBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(journalContainersBucket); err != nil {
+			return err
+		}
+		id := meta.Get(journalIDKey)
+		if id == nil {
+			id = []byte(uuid.NewV4())
+			if err := meta.Put(journalIDKey, id); err != nil {
+				return err
+			}
+		}
+		j.id = string(id)
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "failed to initialize journal %v", path)
+	}
+	return j, nil
+}
+
+// ID uniquely identifies the journal
+func (j *Journal) ID() string {
+	return j.id
+}
+
+func (j *Journal) Close() error {
+	return j.db.Close()
+}
+
+// Get returns the entry of the container. The boolean is false if the
+// container is not in the journal.
+func (j *Journal) Get(containerID string) (JournalEntry, bool, error) {
+	var entry JournalEntry
+	found := false
+	err := j.db.View(func(tx *bolt.Tx) error {
+		bts := tx.Bucket(journalContainersBucket).Get([]byte(containerID))
+		if bts == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(bts, &entry)
+	})
+	if err != nil {
+		return JournalEntry{}, false, errors.Wrapf(err, "failed to read the journal entry of %v", containerID)
+	}
+	return entry, found, nil
+}
+
+// List returns every entry of the journal
+func (j *Journal) List() ([]JournalEntry, error) {
+	entries := []JournalEntry{}
+	err := j.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(journalContainersBucket).ForEach(func(k, v []byte) error {
+			var entry JournalEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return errors.Wrapf(err, "invalid journal entry for %s", k)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list the journal entries")
+	}
+	return entries, nil
+}
+
+// Delete removes the entry of the container
+func (j *Journal) Delete(containerID string) error {
+	return j.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(journalContainersBucket).Delete([]byte(containerID))
+	})
+}
+
+// update applies f to the entry of the container, creating it if needed
+func (j *Journal) update(containerID string, f func(*JournalEntry)) error {
+	return j.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(journalContainersBucket)
+		entry := JournalEntry{ContainerID: containerID}
+		if bts := bucket.Get([]byte(containerID)); bts != nil {
+			if err := json.Unmarshal(bts, &entry); err != nil {
+				return err
+			}
+		}
+		f(&entry)
+		bts, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(containerID), bts)
+	})
+}
+
+// recordState appends a state transition to the entry of the container
+func (j *Journal) recordState(containerID string, state ContainerState, deadline time.Time, remaining time.Duration) error {
+	return j.update(containerID, func(entry *JournalEntry) {
+		entry.State = state
+		entry.Deadline = deadline
+		entry.Remaining = remaining
+		entry.Transitions = append(entry.Transitions, JournalTransition{
+			State: state,
+			Time:  time.Now(),
+		})
+	})
+}
+
+// WithJournal records the containers created by the client in the journal.
+// The journal is reconciled against the daemon when the client is created,
+// see Client.ReconcileJournal, so a journal must only be used by one client.
+func WithJournal(j *Journal) ClientOption {
+	return func(o *ClientOptions) {
+		o.journal = j
+	}
+}
+
+// JobID associates the container with a job in the journal
+func JobID(id string) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.jobID = id
+	}
+}
+
+// journalCreated records a container created by the client
+func (c *Container) journalCreated() {
+	j := c.client.options.journal
+	if j == nil {
+		return
+	}
+	deadline, _ := c.options.context.Deadline()
+	err := j.update(c.ID, func(entry *JournalEntry) {
+		entry.JobID = c.options.jobID
+		entry.GPUs = c.options.visibleGPUs
+	})
+	if err == nil {
+		err = j.recordState(c.ID, c.getState(), deadline, c.Remaining())
+	}
+	if err != nil {
+		log.WithError(err).WithField("container_id", c.ID).Error("failed to journal container")
+	}
+}
+
+// journalState records a state transition of the container. Removed
+// containers are deleted from the journal.
+func (c *Container) journalState(state ContainerState) {
+	j := c.client.options.journal
+	if j == nil {
+		return
+	}
+	var err error
+	if state == StateRemoved {
+		err = j.Delete(c.ID)
+	} else {
+		deadline, _ := c.options.context.Deadline()
+		err = j.recordState(c.ID, state, deadline, c.Remaining())
+	}
+	if err != nil {
+		log.WithError(err).WithField("container_id", c.ID).Error("failed to journal container state")
+	}
+}
+
+// ReconcileResult summarizes the reconciliation of the journal
+type ReconcileResult struct {
+	// Adopted are the live or created containers of the journal
+	Adopted []*Container
+	// Released are the journaled containers that were dead or gone. Their GPU
+	// slots were released and they were removed.
+	Released []string
+	// Orphans are the containers owned by the journal but missing from it,
+	// which were removed
+	Orphans []string
+}
+
+// ReconcileJournal compares the journal of the client with the daemon. Live
+// containers, and the created ones that were not started yet, are adopted.
+// The GPU slots of dead containers are released and the dead containers are
+// removed, as are the containers created with the journal that are missing
+// from it.
+func (c *Client) ReconcileJournal(paramOpts ...ContainerOption) (*ReconcileResult, error) {
+	j := c.options.journal
+	if j == nil {
+		return nil, errors.New("the client does not have a journal")
+	}
+	ctx := c.options.context
+	res := &ReconcileResult{}
+
+	entries, err := j.List()
+	if err != nil {
+		return nil, err
+	}
+	journaled := map[string]bool{}
+	for _, entry := range entries {
+		journaled[entry.ContainerID] = true
+		info, err := c.ContainerInspect(ctx, entry.ContainerID)
+		if err != nil && !errdefs.IsNotFound(err) {
+			return res, errors.Wrapf(err, "failed to inspect container %v", entry.ContainerID)
+		}
+		if err == nil && info.State != nil && isAdoptable(ContainerState(info.State.Status)) {
+			cont, err := c.LoadContainer(entry.ContainerID, paramOpts...)
+			if err != nil {
+				return res, err
+			}
+			res.Adopted = append(res.Adopted, cont)
+			continue
+		}
+		if GPUDeviceUsageState != nil {
+			for key, val := range entry.GPUs {
+				GPUDeviceUsageState.Add(key, val)
+			}
+		}
+		if err == nil {
+			err = c.ContainerRemove(ctx, entry.ContainerID, types.ContainerRemoveOptions{
+				RemoveVolumes: true,
+				Force:         true,
+			})
+			if err != nil && !errdefs.IsNotFound(err) {
+				return res, errors.Wrapf(err, "failed to remove container %v", entry.ContainerID)
+			}
+		}
+		if err := j.Delete(entry.ContainerID); err != nil {
+			return res, errors.Wrapf(err, "failed to delete the journal entry of %v", entry.ContainerID)
+		}
+		res.Released = append(res.Released, entry.ContainerID)
+	}
+
+	filter := filters.NewArgs()
+	filter.Add("label", JournalLabel+"="+j.ID())
+	list, err := c.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filter,
+	})
+	if err != nil {
+		return res, errors.Wrap(err, "failed to list containers")
+	}
+	for _, item := range list {
+		if journaled[item.ID] {
+			continue
+		}
+		err := c.ContainerRemove(ctx, item.ID, types.ContainerRemoveOptions{
+			RemoveVolumes: true,
+			Force:         true,
+		})
+		if err != nil && !errdefs.IsNotFound(err) {
+			return res, errors.Wrapf(err, "failed to remove orphan container %v", item.ID)
+		}
+		res.Orphans = append(res.Orphans, item.ID)
+	}
+	return res, nil
+}
+
+// isAdoptable returns true if a journaled container in the state can still be
+// used, a created container being started later by its owner
+func isAdoptable(state ContainerState) bool {
+	return state.IsActive() || state == StateCreated
+}
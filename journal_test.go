@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// skipBoltRace skips the tests opening a journal under the race detector.
+// bolt v1.3.1 fails its checkptr checks, and go.etcd.io/bbolt v1.3.4, which
+// fixes them, requires a golang.org/x/sys that the pinned docker module does
+// not build with on windows.
+func skipBoltRace(t *testing.T) {
+	if raceEnabled {
+		t.Skip("bolt is not checkptr safe")
+	}
+}
+
+func openTestJournal(t *testing.T) (*Journal, func()) {
+	dir, err := ioutil.TempDir("", "docker-journal")
+	require.NoError(t, err)
+	j, err := OpenJournal(filepath.Join(dir, "journal.db"))
+	require.NoError(t, err)
+	return j, func() {
+		j.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	skipBoltRace(t)
+	dir, err := ioutil.TempDir("", "docker-journal")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.db")
+
+	j, err := OpenJournal(path)
+	require.NoError(t, err)
+	id := j.ID()
+	assert.NotEmpty(t, id)
+
+	deadline := time.Now().Add(time.Hour).Round(0)
+	err = j.update("c1", func(entry *JournalEntry) {
+		entry.JobID = "job"
+		entry.GPUs = map[string]int{"dev[0];hyperq[0]": 0}
+	})
+	require.NoError(t, err)
+	require.NoError(t, j.recordState("c1", StateCreated, deadline, time.Hour))
+	require.NoError(t, j.recordState("c1", StatePaused, time.Time{}, 30*time.Minute))
+	require.NoError(t, j.recordState("c2", StateRunning, deadline, time.Hour))
+	require.NoError(t, j.Close())
+
+	j, err = OpenJournal(path)
+	require.NoError(t, err)
+	defer j.Close()
+	assert.Equal(t, id, j.ID())
+
+	entry, ok, err := j.Get("c1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "job", entry.JobID)
+	assert.Equal(t, map[string]int{"dev[0];hyperq[0]": 0}, entry.GPUs)
+	assert.Equal(t, StatePaused, entry.State)
+	assert.True(t, entry.Deadline.IsZero())
+	assert.Equal(t, 30*time.Minute, entry.Remaining)
+	if assert.Len(t, entry.Transitions, 2) {
+		assert.Equal(t, StateCreated, entry.Transitions[0].State)
+		assert.Equal(t, StatePaused, entry.Transitions[1].State)
+	}
+
+	entries, err := j.List()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	require.NoError(t, j.Delete("c1"))
+	_, ok, err = j.Get("c1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func inspectWithState(id string, status string) http.HandlerFunc {
+	return writeJSON(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    id,
+			State: &types.ContainerState{Status: status},
+		},
+		Config: &container.Config{},
+	})
+}
+
+func TestReconcileJournal(t *testing.T) {
+	skipBoltRace(t)
+	j, closeJournal := openTestJournal(t)
+	defer closeJournal()
+	deadline := time.Now().Add(time.Hour)
+	for _, id := range []string{"running", "created", "exited", "gone"} {
+		require.NoError(t, j.recordState(id, StateCreated, deadline, time.Hour))
+	}
+
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/running/json": inspectWithState("running", "running"),
+		"GET /containers/created/json": inspectWithState("created", "created"),
+		"GET /containers/exited/json":  inspectWithState("exited", "exited"),
+		"DELETE /containers/*":         func(w http.ResponseWriter, r *http.Request) {},
+		"GET /containers/json": writeJSON([]types.Container{
+			{ID: "running"}, {ID: "created"}, {ID: "orphan"},
+		}),
+	})
+	defer d.Close()
+	defer client.Close()
+	client.options.journal = j
+
+	res, err := client.ReconcileJournal()
+	require.NoError(t, err)
+	adopted := map[string]ContainerState{}
+	for _, cont := range res.Adopted {
+		adopted[cont.ID] = cont.getState()
+		cont.release()
+	}
+	assert.Equal(t, map[string]ContainerState{
+		"running": StateRunning,
+		"created": StateCreated,
+	}, adopted)
+	assert.ElementsMatch(t, []string{"exited", "gone"}, res.Released)
+	assert.Equal(t, []string{"orphan"}, res.Orphans)
+	assert.Equal(t, 0, d.Calls("DELETE /containers/created"))
+	assert.Equal(t, 1, d.Calls("DELETE /containers/exited"))
+	assert.Equal(t, 1, d.Calls("DELETE /containers/orphan"))
+
+	entries, err := j.List()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,116 @@
+package docker
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+// LifecycleEventType is a transition in the lifecycle of a container
+type LifecycleEventType string
+
+const (
+	ContainerCreated   LifecycleEventType = "created"
+	ContainerStarted   LifecycleEventType = "started"
+	ExecStarted        LifecycleEventType = "exec-started"
+	ExecFinished       LifecycleEventType = "exec-finished"
+	ContainerOOMKilled LifecycleEventType = "oom-killed"
+	ContainerDied      LifecycleEventType = "died"
+	ContainerTimedOut  LifecycleEventType = "timed-out"
+	ContainerStopped   LifecycleEventType = "stopped"
+	ContainerRemoved   LifecycleEventType = "removed"
+)
+
+// LifecycleEvent describes a transition in the lifecycle of a container.
+// The oom-killed and died events are reported by the daemon, the other events
+// are reported by the methods of Container and Execution.
+type LifecycleEvent struct {
+	Type        LifecycleEventType
+	ContainerID string
+	// ExecID is only set for the exec-started and exec-finished events
+	ExecID string
+	// ExitCode is only set for the exec-finished and died events
+	ExitCode int
+	// Err is the error returned by the execution for exec-finished events
+	Err  error
+	Time time.Time
+}
+
+// LifecycleHook is called for every lifecycle event of the containers it is
+// registered for. Hooks are called synchronously and must not block.
+type LifecycleHook func(LifecycleEvent)
+
+// OnLifecycleEvent registers a hook called for the lifecycle events of every
+// container created by the client.
+func OnLifecycleEvent(h LifecycleHook) ClientOption {
+	return func(o *ClientOptions) {
+		o.lifecycleHooks = append(o.lifecycleHooks, h)
+	}
+}
+
+// OnContainerLifecycleEvent registers a hook called for the lifecycle events
+// of the container.
+func OnContainerLifecycleEvent(h LifecycleHook) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.lifecycleHooks = append(o.lifecycleHooks, h)
+	}
+}
+
+func (c *Container) hasLifecycleHooks() bool {
+	return len(c.client.options.lifecycleHooks) != 0 || len(c.options.lifecycleHooks) != 0
+}
+
+func (c *Container) emit(ev LifecycleEvent) {
+	if !c.hasLifecycleHooks() {
+		return
+	}
+	ev.ContainerID = c.ID
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	for _, h := range c.client.options.lifecycleHooks {
+		h(ev)
+	}
+	for _, h := range c.options.lifecycleHooks {
+		h(ev)
+	}
+}
+
+// watchDaemonEvents tracks the state changes of the container and reports
+// its oom and die events until the context is done.
+func (c *Container) watchDaemonEvents(ctx context.Context) {
+	msgs := c.client.containerEvents(ctx, c.ID, "oom", "die", "start", "pause", "unpause", "destroy")
+	for msg := range msgs {
+		c.handleDaemonEvent(msg)
+	}
+}
+
+func (c *Container) handleDaemonEvent(msg events.Message) {
+	ev := LifecycleEvent{
+		Time: time.Unix(0, msg.TimeNano),
+	}
+	switch msg.Action {
+	case "start", "unpause":
+		c.setState(StateRunning)
+		return
+	case "pause":
+		c.setState(StatePaused)
+		return
+	case "destroy":
+		c.setState(StateRemoved)
+		return
+	case "oom":
+		ev.Type = ContainerOOMKilled
+	case "die":
+		c.setState(StateExited)
+		ev.Type = ContainerDied
+		if code, err := strconv.Atoi(msg.Actor.Attributes["exitCode"]); err == nil {
+			ev.ExitCode = code
+		}
+	default:
+		return
+	}
+	c.emit(ev)
+}
@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamEvents serves the given daemon events and keeps the stream open
+// until the client goes away
+func streamEvents(msgs ...events.Message) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		for _, msg := range msgs {
+			enc.Encode(msg)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+}
+
+// lifecycleRecorder records the events received by the hooks
+type lifecycleRecorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *lifecycleRecorder) hook(name string) LifecycleHook {
+	return func(ev LifecycleEvent) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.events = append(r.events, name+":"+string(ev.Type))
+	}
+}
+
+func (r *lifecycleRecorder) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.events...)
+}
+
+func lifecycleRoutes(daemonEvents ...events.Message) map[string]http.HandlerFunc {
+	killed := []string{}
+	routes := stopRoutes(&killed)
+	for key, route := range execRoutes(map[string]fakeCommand{"make": {ExitCode: 2}}) {
+		routes[key] = route
+	}
+	routes["GET /images/json"] = writeJSON([]types.ImageSummary{{ID: "sha256:1"}})
+	routes["POST /containers/create"] = writeJSON(container.ContainerCreateCreatedBody{ID: "c1"})
+	routes["POST /containers/c1/start"] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	routes["GET /events"] = streamEvents(daemonEvents...)
+	return routes
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	d, client := newFakeDaemon(t, lifecycleRoutes())
+	defer d.Close()
+	defer client.Close()
+	rec := &lifecycleRecorder{}
+	client.options.lifecycleHooks = []LifecycleHook{rec.hook("client")}
+
+	finished := LifecycleEvent{}
+	cont, err := NewContainer(client,
+		OnContainerLifecycleEvent(rec.hook("container")),
+		OnContainerLifecycleEvent(func(ev LifecycleEvent) {
+			if ev.Type == ExecFinished {
+				finished = ev
+			}
+		}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, cont.Start())
+	exec, err := NewExecution(cont, "make")
+	require.NoError(t, err)
+	require.NoError(t, exec.Run())
+	require.NoError(t, cont.Stop())
+
+	// the hooks of the client are called before the ones of the container
+	expected := []string{}
+	for _, ev := range []LifecycleEventType{
+		ContainerCreated, ContainerStarted, ExecStarted, ExecFinished, ContainerStopped, ContainerRemoved,
+	} {
+		expected = append(expected, "client:"+string(ev), "container:"+string(ev))
+	}
+	assert.Equal(t, expected, rec.Events())
+	// the execution shares the event subscription of the container
+	assert.Equal(t, 1, d.Calls("GET /events"))
+	assert.Equal(t, "c1", finished.ContainerID)
+	assert.Equal(t, exec.execID, finished.ExecID)
+	assert.Equal(t, 2, finished.ExitCode)
+	assert.False(t, finished.Time.IsZero())
+}
+
+func TestLifecycleDaemonEvents(t *testing.T) {
+	d, client := newFakeDaemon(t, lifecycleRoutes(
+		events.Message{Type: "container", Action: "oom", Actor: events.Actor{ID: "c1"}, TimeNano: 1},
+		events.Message{Type: "container", Action: "die", Actor: events.Actor{
+			ID:         "c1",
+			Attributes: map[string]string{"exitCode": "137"},
+		}, TimeNano: 2},
+	))
+	defer d.Close()
+	defer client.Close()
+
+	rec := &lifecycleRecorder{}
+	codes := make(chan int, 1)
+	cont, err := NewContainer(client,
+		OnContainerLifecycleEvent(rec.hook("container")),
+		OnContainerLifecycleEvent(func(ev LifecycleEvent) {
+			if ev.Type == ContainerDied {
+				codes <- ev.ExitCode
+			}
+		}),
+	)
+	require.NoError(t, err)
+	defer cont.release()
+
+	assert.Equal(t, 137, <-codes)
+	assert.Equal(t, []string{"container:created", "container:oom-killed", "container:died"}, rec.Events())
+	assert.Equal(t, StateExited, cont.getState())
+}
@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/stringid"
+)
+
+// LinePrefix holds the information available to a LinePrefixFunc when
+// formatting the prefix of an output line.
+type LinePrefix struct {
+	// ContainerID is the full id of the container producing the output
+	ContainerID string
+	// Name is the name of the execution producing the output. It is empty
+	// when the output is produced by the container's main process.
+	Name string
+	// Stream is either StdoutStream or StderrStream
+	Stream string
+	// Time is the time at which the line was completed
+	Time time.Time
+}
+
+// ShortID returns the truncated container id as displayed by the docker cli
+func (p LinePrefix) ShortID() string {
+	return stringid.TruncateID(p.ContainerID)
+}
+
+// LinePrefixFunc returns the prefix written in front of every output line
+type LinePrefixFunc func(LinePrefix) string
+
+// DefaultLinePrefix formats the prefix as "[short_id/name:stream] ".
+func DefaultLinePrefix(p LinePrefix) string {
+	s := "[" + p.ShortID()
+	if p.Name != "" {
+		s += "/" + p.Name
+	}
+	return s + ":" + p.Stream + "] "
+}
+
+// TimestampLinePrefix formats the prefix as DefaultLinePrefix preceded by the
+// time the line was completed using the given layout.
+func TimestampLinePrefix(layout string) LinePrefixFunc {
+	return func(p LinePrefix) string {
+		return p.Time.Format(layout) + " " + DefaultLinePrefix(p)
+	}
+}
+
+// LineWriter buffers the bytes written to it and forwards them to the
+// underlying stream one complete line at a time, so that the output of
+// several writers sharing a stream does not interleave mid-line. A partial
+// last line is forwarded when the writer is closed.
+type LineWriter struct {
+	mu     sync.Mutex
+	out    *OutStream
+	prefix LinePrefix
+	format LinePrefixFunc
+	buf    []byte
+}
+
+// NewLineWriter returns a LineWriter writing to out. If format is nil, lines
+// are written without a prefix.
+func NewLineWriter(out io.Writer, prefix LinePrefix, format LinePrefixFunc) *LineWriter {
+	s, ok := out.(*OutStream)
+	if !ok {
+		s = NewOutStream(out)
+	}
+	return &LineWriter{
+		out:    s,
+		prefix: prefix,
+		format: format,
+	}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx == -1 {
+			break
+		}
+		if err := w.writeLine(w.buf[:idx+1]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[idx+1:]
+	}
+	return len(p), nil
+}
+
+// writeLine writes the line along with its prefix using a single write so
+// that the OutStream lock keeps it in one piece.
+func (w *LineWriter) writeLine(line []byte) error {
+	if w.format == nil {
+		_, err := w.out.Write(line)
+		return err
+	}
+	prefix := w.prefix
+	prefix.Time = time.Now()
+	_, err := w.out.Write(append([]byte(w.format(prefix)), line...))
+	return err
+}
+
+// Flush writes the buffered partial line, if any, terminated by a newline.
+func (w *LineWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := append(w.buf, '\n')
+	w.buf = nil
+	return w.writeLine(line)
+}
+
+// Close implements the Closer interface by flushing the partial line. The
+// underlying stream is not closed.
+func (w *LineWriter) Close() error {
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineWriterPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLineWriter(&buf, LinePrefix{
+		ContainerID: "0123456789abcdef0123",
+		Name:        "make",
+		Stream:      StdoutStream,
+	}, DefaultLinePrefix)
+
+	w.Write([]byte("hello "))
+	assert.Empty(t, buf.String())
+	w.Write([]byte("world\npartial"))
+	assert.Equal(t, "[0123456789ab/make:stdout] hello world\n", buf.String())
+
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "[0123456789ab/make:stdout] hello world\n[0123456789ab/make:stdout] partial\n", buf.String())
+}
+
+func TestLineWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	out := NewOutStream(&buf)
+
+	var wg sync.WaitGroup
+	for ii := 0; ii < 8; ii++ {
+		wg.Add(1)
+		go func(ii int) {
+			defer wg.Done()
+			w := NewLineWriter(out, LinePrefix{Name: fmt.Sprint(ii)}, nil)
+			defer w.Close()
+			for jj := 0; jj < 100; jj++ {
+				w.Write([]byte(fmt.Sprintf("writer %d ", ii)))
+				w.Write([]byte(fmt.Sprintf("line %d\n", jj)))
+			}
+		}(ii)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 800)
+	for _, line := range lines {
+		var ii, jj int
+		_, err := fmt.Sscanf(line, "writer %d line %d", &ii, &jj)
+		assert.NoError(t, err, line)
+	}
+}
+
+func TestExecutionDefaultOutputNil(t *testing.T) {
+	e := &Execution{container: &Container{client: &Client{}}}
+	assert.True(t, e.defaultOutput(StdoutStream, nil) == nil)
+
+	e.container.client.options.lineOutput = true
+	assert.True(t, e.defaultOutput(StdoutStream, nil) == nil)
+}
@@ -0,0 +1,184 @@
+package docker
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+)
+
+// Labels recorded on the containers at creation so that they can be
+// supervised again by LoadContainer
+const (
+	GPUsLabel      = "rai.docker.gpus"
+	TimelimitLabel = "rai.docker.time_limit"
+	JobIDLabel     = "rai.docker.job_id"
+)
+
+func (o *ContainerOptions) recordLabels(c *Client) {
+	if o.containerConfig.Labels == nil {
+		o.containerConfig.Labels = map[string]string{}
+	}
+	o.containerConfig.Labels[TimelimitLabel] = o.timelimit.String()
+	if o.jobID != "" {
+		o.containerConfig.Labels[JobIDLabel] = o.jobID
+	}
+	if c.options.journal != nil {
+		o.containerConfig.Labels[JournalLabel] = c.options.journal.ID()
+	}
+	if len(o.visibleGPUs) != 0 {
+		if bts, err := json.Marshal(o.visibleGPUs); err == nil {
+			o.containerConfig.Labels[GPUsLabel] = string(bts)
+		}
+	}
+}
+
+// LoadContainer returns a handle to an existing container. The options of
+// the container are reconstructed from its configuration and from the labels
+// recorded when it was created. The time the container existed for is
+// deducted from its time limit, so the container is stopped right away if the
+// limit was exceeded. Unless the container is in the journal of the client,
+// the time the container spent paused before it was loaded is not known and
+// is counted against the time limit.
+func (c *Client) LoadContainer(id string, paramOpts ...ContainerOption) (*Container, error) {
+	info, err := c.ContainerInspect(c.options.context, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to inspect container %v", id)
+	}
+	if info.ContainerJSONBase == nil || info.Config == nil {
+		return nil, errors.Errorf("incomplete information for container %v", id)
+	}
+
+	timelimit := Config.TimeLimit
+	if s, ok := info.Config.Labels[TimelimitLabel]; ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			timelimit = d
+		}
+	}
+	remaining := timelimit
+	if created, err := time.Parse(time.RFC3339Nano, info.Created); err == nil {
+		remaining -= time.Since(created)
+	}
+	if j := c.options.journal; j != nil {
+		if entry, ok, err := j.Get(info.ID); err == nil && ok {
+			remaining = entry.Remaining
+			if !entry.Deadline.IsZero() {
+				remaining = time.Until(entry.Deadline)
+			}
+		}
+	}
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	hostConfig := info.HostConfig
+	if hostConfig == nil {
+		hostConfig = &container.HostConfig{}
+	}
+	networkConfig := &network.NetworkingConfig{}
+	if info.NetworkSettings != nil {
+		networkConfig.EndpointsConfig = info.NetworkSettings.Networks
+	}
+	ctx, cancelFunc := withTimelimit(c.options.context, remaining)
+	options := &ContainerOptions{
+		name:            strings.TrimPrefix(info.Name, "/"),
+		jobID:           info.Config.Labels[JobIDLabel],
+		runtime:         hostConfig.Runtime,
+		containerConfig: info.Config,
+		hostConfig:      hostConfig,
+		networkConfig:   networkConfig,
+		timelimit:       timelimit,
+		parentCtx:       c.options.context,
+		context:         ctx,
+		cancelFunc:      cancelFunc,
+	}
+	if s, ok := info.Config.Labels[GPUsLabel]; ok {
+		if err := json.Unmarshal([]byte(s), &options.visibleGPUs); err != nil {
+			log.WithError(err).WithField("container_id", id).Warn("invalid gpu assignment label")
+		}
+	}
+	for _, o := range paramOpts {
+		o(options)
+	}
+	if options.err != nil {
+		cancelFunc()
+		return nil, options.err
+	}
+
+	// the devices are still used by the container
+	if GPUDeviceUsageState != nil {
+		for key := range options.visibleGPUs {
+			GPUDeviceUsageState.Remove(key)
+		}
+	}
+
+	cont := &Container{
+		ID:      info.ID,
+		client:  c,
+		options: *options,
+		state:   StateCreated,
+	}
+	if info.State != nil {
+		cont.setState(ContainerState(info.State.Status))
+	}
+	cont.supervise()
+	return cont, nil
+}
+
+// FindContainers returns a handle to every container, running or not, that
+// has all of the given labels.
+func (c *Client) FindContainers(labels map[string]string, paramOpts ...ContainerOption) ([]*Container, error) {
+	filter := filters.NewArgs()
+	for k, v := range labels {
+		filter.Add("label", k+"="+v)
+	}
+	list, err := c.ContainerList(c.options.context, types.ContainerListOptions{
+		All:     true,
+		Filters: filter,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list containers")
+	}
+	res := []*Container{}
+	for _, item := range list {
+		cont, err := c.LoadContainer(item.ID, paramOpts...)
+		if err != nil {
+			if errdefs.IsNotFound(errors.Cause(err)) {
+				// removed in the meantime
+				continue
+			}
+			for _, loaded := range res {
+				loaded.release()
+			}
+			return nil, err
+		}
+		res = append(res, cont)
+	}
+	return res, nil
+}
+
+// release stops supervising a loaded container and gives back the GPUs that
+// LoadContainer took from the usage state
+func (c *Container) release() {
+	if c.cancelEvents != nil {
+		c.cancelEvents()
+	}
+	c.options.cancelFunc()
+	c.releaseGPUs()
+}
+
+// releaseGPUs marks the GPUs assigned to the container as available
+func (c *Container) releaseGPUs() {
+	if c.options.visibleGPUs == nil || GPUDeviceUsageState == nil {
+		return
+	}
+	for key, val := range c.options.visibleGPUs {
+		GPUDeviceUsageState.Add(key, val)
+	}
+}
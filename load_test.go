@@ -0,0 +1,104 @@
+package docker
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	lru "github.com/flyaways/golang-lru"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func inspectWithLabels(id string, created time.Time, labels map[string]string) http.HandlerFunc {
+	return writeJSON(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         id,
+			Name:       "/rai-" + id,
+			Created:    created.Format(time.RFC3339Nano),
+			State:      &types.ContainerState{Status: "running", Running: true},
+			HostConfig: &container.HostConfig{Runtime: "nvidia"},
+		},
+		Config: &container.Config{
+			Image:  "ubuntu:16.04",
+			Labels: labels,
+		},
+	})
+}
+
+// testGPUUsageState replaces the usage state by one with two free slots
+func testGPUUsageState(t *testing.T) func() {
+	prev := GPUDeviceUsageState
+	cache, err := lru.New(2)
+	require.NoError(t, err)
+	cache.Add("dev[0];hyperq[0]", 0)
+	cache.Add("dev[1];hyperq[0]", 1)
+	GPUDeviceUsageState = &GPUUsageState{Cache: cache}
+	return func() {
+		GPUDeviceUsageState = prev
+	}
+}
+
+func TestLoadContainer(t *testing.T) {
+	defer testGPUUsageState(t)()
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/c1/json": inspectWithLabels("c1", time.Now().Add(-10*time.Minute), map[string]string{
+			TimelimitLabel: "1h0m0s",
+			JobIDLabel:     "job-1",
+			GPUsLabel:      `{"dev[1];hyperq[0]":1}`,
+		}),
+	})
+	defer d.Close()
+	defer client.Close()
+
+	cont, err := client.LoadContainer("c1")
+	require.NoError(t, err)
+	defer cont.release()
+
+	assert.Equal(t, "c1", cont.ID)
+	assert.Equal(t, "rai-c1", cont.options.name)
+	assert.Equal(t, "job-1", cont.options.jobID)
+	assert.Equal(t, "nvidia", cont.options.runtime)
+	assert.Equal(t, time.Hour, cont.options.timelimit)
+	assert.Equal(t, map[string]int{"dev[1];hyperq[0]": 1}, cont.options.visibleGPUs)
+	assert.Equal(t, StateRunning, cont.getState())
+	assert.InDelta(t, float64(50*time.Minute), float64(cont.Remaining()), float64(time.Minute))
+	assert.False(t, GPUDeviceUsageState.Contains("dev[1];hyperq[0]"))
+}
+
+func TestLoadContainerExceededTimelimit(t *testing.T) {
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/c1/json": inspectWithLabels("c1", time.Now().Add(-2*time.Hour), map[string]string{
+			TimelimitLabel: "1h0m0s",
+		}),
+	})
+	defer d.Close()
+	defer client.Close()
+
+	cont, err := client.LoadContainer("c1")
+	require.NoError(t, err)
+	defer cont.release()
+	assert.Equal(t, time.Duration(0), cont.Remaining())
+}
+
+func TestFindContainersReleasesOnError(t *testing.T) {
+	defer testGPUUsageState(t)()
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"GET /containers/json": writeJSON([]types.Container{{ID: "c1"}, {ID: "c2"}}),
+		"GET /containers/c1/json": inspectWithLabels("c1", time.Now(), map[string]string{
+			GPUsLabel: `{"dev[0];hyperq[0]":0}`,
+		}),
+		"GET /containers/c2/json": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"message":"daemon error"}`, http.StatusInternalServerError)
+		},
+	})
+	defer d.Close()
+	defer client.Close()
+
+	_, err := client.FindContainers(map[string]string{JobIDLabel: "job-1"})
+	require.Error(t, err)
+	assert.True(t, GPUDeviceUsageState.Contains("dev[0];hyperq[0]"))
+	assert.Equal(t, 2, GPUDeviceUsageState.Len())
+}
@@ -0,0 +1,162 @@
+package docker
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// LimitPolicy determines what happens to an output stream once it exceeds
+// its byte limit.
+type LimitPolicy int
+
+const (
+	// LimitTruncate keeps the first bytes of the stream, writes a marker and
+	// discards the rest.
+	LimitTruncate LimitPolicy = iota
+	// LimitHeadTail keeps the first and the last half of the limit and
+	// replaces the bytes in between by a marker.
+	LimitHeadTail
+	// LimitKill writes a marker and kills the process producing the output.
+	LimitKill
+)
+
+func (p LimitPolicy) String() string {
+	switch p {
+	case LimitTruncate:
+		return "truncate"
+	case LimitHeadTail:
+		return "head-tail"
+	case LimitKill:
+		return "kill"
+	}
+	return fmt.Sprintf("LimitPolicy(%d)", int(p))
+}
+
+// OutputLimit limits the number of bytes copied from a stream to its writer.
+// The zero value does not limit the stream.
+type OutputLimit struct {
+	Bytes  int64
+	Policy LimitPolicy
+}
+
+// IsZero returns true if the limit does not restrict the output
+func (l OutputLimit) IsZero() bool {
+	return l.Bytes <= 0
+}
+
+// OutputLimitError is returned when a stream exceeded its limit and the
+// LimitKill policy terminated the process that produced it.
+type OutputLimitError struct {
+	Stream string
+	Limit  OutputLimit
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("Docker: %s exceeded the output limit of %d bytes", e.Stream, e.Limit.Bytes)
+}
+
+// limitWriter forwards at most limit.Bytes bytes to the underlying writer.
+// Writes beyond the limit are reported as successful so that the copy from
+// the hijacked connection keeps draining the stream.
+type limitWriter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	stream   string
+	limit    OutputLimit
+	written  int64
+	total    int64
+	tail     []byte
+	exceeded bool
+	flushed  bool
+	onExceed func(stream string)
+}
+
+func newLimitWriter(stream string, out io.Writer, limit OutputLimit, onExceed func(string)) *limitWriter {
+	return &limitWriter{
+		out:      out,
+		stream:   stream,
+		limit:    limit,
+		onExceed: onExceed,
+	}
+}
+
+func (w *limitWriter) headLimit() int64 {
+	if w.limit.Policy == LimitHeadTail {
+		return w.limit.Bytes / 2
+	}
+	return w.limit.Bytes
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	w.total += int64(n)
+
+	if head := w.headLimit() - w.written; head > 0 {
+		chunk := p
+		if int64(len(chunk)) > head {
+			chunk = chunk[:head]
+		}
+		m, err := w.out.Write(chunk)
+		w.written += int64(m)
+		if err != nil {
+			return m, err
+		}
+		p = p[len(chunk):]
+	}
+	if len(p) == 0 {
+		return n, nil
+	}
+
+	if w.limit.Policy == LimitHeadTail {
+		// the tail is only known once the stream is closed, keep the last
+		// bytes around until Flush is called
+		keep := int(w.limit.Bytes - w.headLimit())
+		w.tail = append(w.tail, p...)
+		if len(w.tail) > keep {
+			w.tail = append(w.tail[:0], w.tail[len(w.tail)-keep:]...)
+		}
+		if w.total <= w.limit.Bytes {
+			return n, nil
+		}
+	}
+
+	if !w.exceeded {
+		w.exceeded = true
+		if w.limit.Policy != LimitHeadTail {
+			fmt.Fprintf(w.out, "\n[%s truncated after %d bytes]\n", w.stream, w.limit.Bytes)
+		}
+		if w.onExceed != nil {
+			w.onExceed(w.stream)
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the kept tail of the stream when using the LimitHeadTail
+// policy. It is a no-op for the other policies.
+func (w *limitWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.flushed || w.limit.Policy != LimitHeadTail {
+		return nil
+	}
+	w.flushed = true
+	if w.exceeded {
+		omitted := w.total - w.written - int64(len(w.tail))
+		fmt.Fprintf(w.out, "\n[%s: %d bytes omitted]\n", w.stream, omitted)
+	}
+	_, err := w.out.Write(w.tail)
+	w.tail = nil
+	return err
+}
+
+// Exceeded returns true if more than limit.Bytes bytes were written
+func (w *limitWriter) Exceeded() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.exceeded
+}
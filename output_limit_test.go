@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputLimitTruncate(t *testing.T) {
+	var buf bytes.Buffer
+	w := newLimitWriter(StdoutStream, &buf, OutputLimit{Bytes: 4, Policy: LimitTruncate}, nil)
+
+	n, err := w.Write([]byte("ab"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.False(t, w.Exceeded())
+
+	n, err = w.Write([]byte("cdef"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.True(t, w.Exceeded())
+
+	w.Write([]byte("ghi"))
+	w.Flush()
+	assert.True(t, strings.HasPrefix(buf.String(), "abcd\n[stdout truncated after 4 bytes]"))
+	assert.NotContains(t, buf.String(), "ghi")
+}
+
+func TestOutputLimitHeadTail(t *testing.T) {
+	var buf bytes.Buffer
+	w := newLimitWriter(StderrStream, &buf, OutputLimit{Bytes: 6, Policy: LimitHeadTail}, nil)
+	w.Write([]byte("0123"))
+	w.Write([]byte("456789"))
+	w.Flush()
+	assert.True(t, w.Exceeded())
+	assert.Equal(t, "012\n[stderr: 4 bytes omitted]\n789", buf.String())
+
+	buf.Reset()
+	w = newLimitWriter(StderrStream, &buf, OutputLimit{Bytes: 6, Policy: LimitHeadTail}, nil)
+	w.Write([]byte("01234"))
+	w.Flush()
+	assert.False(t, w.Exceeded())
+	assert.Equal(t, "01234", buf.String())
+}
+
+func TestOutputLimitKill(t *testing.T) {
+	var buf bytes.Buffer
+	exceeded := []string{}
+	w := newLimitWriter(StdoutStream, &buf, OutputLimit{Bytes: 2, Policy: LimitKill}, func(stream string) {
+		exceeded = append(exceeded, stream)
+	})
+	w.Write([]byte("abc"))
+	w.Write([]byte("def"))
+	assert.Equal(t, []string{StdoutStream}, exceeded)
+}
+
+func TestAttachOutputLimitExceeded(t *testing.T) {
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"POST /containers/c1/attach": hijack(func(r *http.Request, conn net.Conn, rw *bufio.ReadWriter) {
+			rw.WriteString(strings.Repeat("x", 100))
+			rw.Flush()
+		}),
+	})
+	defer d.Close()
+	defer client.Close()
+	opts := NewContainerOptions(client,
+		Tty(true),
+		OutputLimits(OutputLimit{Bytes: 10, Policy: LimitTruncate}, OutputLimit{}),
+	)
+	defer opts.cancelFunc()
+	cont := &Container{ID: "c1", client: client, options: *opts}
+
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, cont.AttachStreams(nil, &stdout, &stderr))
+	assert.Equal(t, []string{StdoutStream}, cont.OutputLimitExceeded())
+	assert.True(t, strings.HasPrefix(stdout.String(), strings.Repeat("x", 10)+"\n"))
+}
+
+// blockingWriter signals its first write and blocks it until released
+type blockingWriter struct {
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	close(w.writing)
+	<-w.release
+	return len(p), nil
+}
+
+// signalingWriter sends the size of its writes
+type signalingWriter chan int
+
+func (w signalingWriter) Write(p []byte) (int, error) {
+	w <- len(p)
+	return len(p), nil
+}
+
+func TestAttachOutputLimitAfterCancel(t *testing.T) {
+	// a stderr frame followed by a stdout frame over the limit
+	frames := &bytes.Buffer{}
+	stdcopy.NewStdWriter(frames, stdcopy.Stderr).Write([]byte("e"))
+	stdcopy.NewStdWriter(frames, stdcopy.Stdout).Write([]byte(strings.Repeat("x", 100)))
+	d, client := newFakeDaemon(t, map[string]http.HandlerFunc{
+		"POST /containers/c1/attach": hijack(func(r *http.Request, conn net.Conn, rw *bufio.ReadWriter) {
+			rw.Write(frames.Bytes())
+			rw.Flush()
+			ioutil.ReadAll(rw)
+		}),
+	})
+	defer d.Close()
+	defer client.Close()
+	opts := NewContainerOptions(client,
+		Tty(false),
+		OutputLimits(OutputLimit{Bytes: 10, Policy: LimitKill}, OutputLimit{}),
+	)
+	cont := &Container{ID: "c1", client: client, options: *opts}
+
+	// the attach returns once canceled while the copy of the output is
+	// blocked, the limit is exceeded afterwards
+	stdout := make(signalingWriter, 2)
+	stderr := &blockingWriter{writing: make(chan struct{}), release: make(chan struct{})}
+	go func() {
+		<-stderr.writing
+		opts.cancelFunc()
+		time.Sleep(100 * time.Millisecond)
+		close(stderr.release)
+	}()
+	assert.NoError(t, cont.AttachStreams(nil, stdout, stderr))
+	assert.Equal(t, 10, <-stdout)
+	// the marker is written right before the limit is reported
+	<-stdout
+	time.Sleep(100 * time.Millisecond)
+}
@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package docker
+
+// raceEnabled is true when the tests are run with the race detector
+const raceEnabled = true
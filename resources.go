@@ -0,0 +1,162 @@
+package docker
+
+import (
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/container"
+	units "github.com/docker/go-units"
+	"github.com/pkg/errors"
+)
+
+// applyResourceDefaults sets the resource limits configured in the docker
+// section of the configuration
+func applyResourceDefaults(h *container.HostConfig) {
+	if Config.CPUs > 0 {
+		h.NanoCPUs = int64(Config.CPUs * 1e9)
+	}
+	h.CpusetCpus = Config.CpusetCpus
+	h.CpusetMems = Config.CpusetMems
+	if Config.PidsLimit != 0 {
+		pids := Config.PidsLimit
+		h.PidsLimit = &pids
+	}
+	for _, ulimit := range Config.Ulimits {
+		setUlimit(&h.Resources, ulimit.Name, ulimit.Soft, ulimit.Hard)
+	}
+	if Config.ShmSize != 0 {
+		h.ShmSize = Config.ShmSize
+	}
+	if Config.MemoryReservation != 0 {
+		h.MemoryReservation = Config.MemoryReservation
+	}
+	if Config.MemorySwap != 0 {
+		h.MemorySwap = Config.MemorySwap
+	}
+	if Config.BlkioWeight != 0 {
+		h.BlkioWeight = uint16(Config.BlkioWeight)
+	}
+	for _, dev := range Config.DeviceReadBps {
+		h.BlkioDeviceReadBps = setThrottleDevice(h.BlkioDeviceReadBps, dev.Path, dev.Rate)
+	}
+	for _, dev := range Config.DeviceWriteBps {
+		h.BlkioDeviceWriteBps = setThrottleDevice(h.BlkioDeviceWriteBps, dev.Path, dev.Rate)
+	}
+}
+
+// NanoCPUs limits the CPU time of the container, in units of 1e-9 CPUs
+func NanoCPUs(n int64) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.Resources.NanoCPUs = n
+	}
+}
+
+// CpusetCpus sets the CPUs the container may run on, for example 0-3 or 0,1
+func CpusetCpus(s string) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.Resources.CpusetCpus = s
+	}
+}
+
+// CpusetMems sets the memory nodes the container may use
+func CpusetMems(s string) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.Resources.CpusetMems = s
+	}
+}
+
+// PidsLimit limits the number of processes of the container. A negative
+// limit removes the limit.
+func PidsLimit(n int64) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.Resources.PidsLimit = &n
+	}
+}
+
+// Ulimit sets the soft and hard values of the ulimit, such as nofile, nproc
+// or core, replacing the previous values.
+func Ulimit(name string, soft, hard int64) ContainerOption {
+	return func(o *ContainerOptions) {
+		setUlimit(&o.hostConfig.Resources, name, soft, hard)
+	}
+}
+
+// setUlimit replaces the ulimit without modifying the previous ones, which
+// may be shared with the host configuration of the caller
+func setUlimit(r *container.Resources, name string, soft, hard int64) {
+	ulimits := append([]*units.Ulimit{}, r.Ulimits...)
+	ulimit := &units.Ulimit{Name: name, Soft: soft, Hard: hard}
+	for ii := range ulimits {
+		if ulimits[ii].Name == name {
+			ulimits[ii] = ulimit
+			r.Ulimits = ulimits
+			return
+		}
+	}
+	r.Ulimits = append(ulimits, ulimit)
+}
+
+// ShmSize sets the size of /dev/shm in bytes
+func ShmSize(n int64) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.ShmSize = n
+	}
+}
+
+// MemoryReservation sets the soft memory limit of the container in bytes
+func MemoryReservation(n int64) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.Resources.MemoryReservation = n
+	}
+}
+
+// MemorySwap sets the limit of memory plus swap of the container in bytes.
+// A limit of -1 allows unlimited swap.
+func MemorySwap(n int64) ContainerOption {
+	return func(o *ContainerOptions) {
+		o.hostConfig.Resources.MemorySwap = n
+	}
+}
+
+// BlkioWeight sets the relative block IO weight, between 10 and 1000
+func BlkioWeight(w uint16) ContainerOption {
+	return func(o *ContainerOptions) {
+		if !validBlkioWeight(int(w)) {
+			o.setError(errors.Errorf("invalid blkio weight %d, it must be between 10 and 1000", w))
+			return
+		}
+		o.hostConfig.Resources.BlkioWeight = w
+	}
+}
+
+func validBlkioWeight(w int) bool {
+	return w >= 10 && w <= 1000
+}
+
+// DeviceReadBps limits the read rate from the device in bytes per second
+func DeviceReadBps(path string, rate uint64) ContainerOption {
+	return func(o *ContainerOptions) {
+		r := &o.hostConfig.Resources
+		r.BlkioDeviceReadBps = setThrottleDevice(r.BlkioDeviceReadBps, path, rate)
+	}
+}
+
+// DeviceWriteBps limits the write rate to the device in bytes per second
+func DeviceWriteBps(path string, rate uint64) ContainerOption {
+	return func(o *ContainerOptions) {
+		r := &o.hostConfig.Resources
+		r.BlkioDeviceWriteBps = setThrottleDevice(r.BlkioDeviceWriteBps, path, rate)
+	}
+}
+
+// setThrottleDevice replaces the rate of the device without modifying the
+// previous ones
+func setThrottleDevice(devs []*blkiodev.ThrottleDevice, path string, rate uint64) []*blkiodev.ThrottleDevice {
+	devs = append([]*blkiodev.ThrottleDevice{}, devs...)
+	dev := &blkiodev.ThrottleDevice{Path: path, Rate: rate}
+	for ii := range devs {
+		if devs[ii].Path == path {
+			devs[ii] = dev
+			return devs
+		}
+	}
+	return append(devs, dev)
+}
@@ -0,0 +1,335 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/pkg/errors"
+)
+
+// RunInput is content copied into the container before it is started.
+// Exactly one of Archive and HostPath must be set.
+type RunInput struct {
+	// Path is the absolute path of the directory of the container the
+	// content is extracted to. It is created if it does not exist.
+	Path string
+	// Archive is a tar stream
+	Archive io.Reader
+	// HostPath is a file or directory of the host
+	HostPath string
+}
+
+// RunSpec describes a container that is run to completion by Client.Run.
+// Exactly one of Command and Script must be set.
+type RunSpec struct {
+	Image   string
+	Inputs  []RunInput
+	Command []string
+	Script  []Step
+	Env     map[string]string
+	Dir     string
+	// Outputs are the paths of the container collected once the command
+	// finished
+	Outputs []string
+	// ArtifactLimit is the maximum size in bytes of the archive of each
+	// output. It defaults to DefaultArtifactLimit.
+	ArtifactLimit int64
+	Memory        int64
+	Timelimit     time.Duration
+	OutputLimit   OutputLimit
+	// Options are applied after the options derived from the other fields
+	Options []ContainerOption
+}
+
+// RunStats summarizes the resource usage of the container at the end of the
+// run
+type RunStats struct {
+	CPUTime   time.Duration
+	MaxMemory uint64
+	Pids      uint64
+}
+
+// DefaultArtifactLimit is the maximum size of the archive of an output when
+// the run does not set one
+const DefaultArtifactLimit = 64 << 20
+
+type RunResult struct {
+	ContainerID string
+	// ExitCode is the exit code of the command or of the last step of the
+	// script that was run
+	ExitCode int
+	// Logs is the combined output of the command
+	Logs []byte
+	// Steps is only set when running a script
+	Steps []StepResult
+	// Artifacts maps the output paths to a tar archive of their content. An
+	// archive larger than the artifact limit of the run fails the run with
+	// ErrFileTooLarge.
+	Artifacts  map[string][]byte
+	Stats      RunStats
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Duration is the time taken by the command
+func (r *RunResult) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// Run creates a container, copies the inputs into it, starts it, runs the
+// command or script and collects the outputs. The container is stopped and removed
+// before returning, whether the run succeeded or not. A non-zero exit code is
+// not an error: it is reported in the result and the outputs are still
+// collected. If the time limit of the container is exceeded,
+// ErrTimelimitExceeded is returned.
+func (c *Client) Run(ctx context.Context, spec RunSpec) (res *RunResult, err error) {
+	if (len(spec.Command) == 0) == (len(spec.Script) == 0) {
+		return nil, errors.New("exactly one of the command and the script of the run must be set")
+	}
+	if err := validateRunInputs(spec.Inputs); err != nil {
+		return nil, err
+	}
+
+	opts := []ContainerOption{ContainerContext(ctx)}
+	if spec.Image != "" {
+		opts = append(opts, Image(spec.Image))
+	}
+	if spec.Memory != 0 {
+		opts = append(opts, Memory(spec.Memory))
+	}
+	if spec.Timelimit != 0 {
+		opts = append(opts, Timelimit(spec.Timelimit))
+	}
+	for k, v := range spec.Env {
+		opts = append(opts, AddEnv(k, v))
+	}
+	if spec.Dir != "" {
+		opts = append(opts, WorkingDirectory(spec.Dir))
+	}
+	opts = append(opts, spec.Options...)
+
+	cont, err := NewContainer(c, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create container")
+	}
+	defer func() {
+		if stopErr := cont.Stop(); stopErr != nil {
+			if err == nil {
+				err = stopErr
+			} else {
+				log.WithError(stopErr).WithField("container_id", cont.ID).Error("failed to stop container")
+			}
+		}
+	}()
+
+	res = &RunResult{
+		ContainerID: cont.ID,
+		ExitCode:    -1,
+		Artifacts:   map[string][]byte{},
+	}
+
+	if err := cont.copyRunInputs(spec.Inputs); err != nil {
+		return res, err
+	}
+	if err := cont.Start(); err != nil {
+		return res, errors.Wrap(err, "failed to start container")
+	}
+
+	logs := &lockedBuffer{}
+	res.StartedAt = time.Now()
+	runErr := cont.runCommand(spec, logs, res)
+	res.FinishedAt = time.Now()
+	res.Logs = logs.Bytes()
+
+	if runErr != nil {
+		if _, ok := errors.Cause(runErr).(*ExitError); !ok {
+			if ctx.Err() == nil && cont.options.context.Err() == context.DeadlineExceeded {
+				return res, ErrTimelimitExceeded
+			}
+			return res, runErr
+		}
+	}
+
+	if stats, err := cont.stats(); err != nil {
+		log.WithError(err).WithField("container_id", cont.ID).Warn("failed to collect container stats")
+	} else {
+		res.Stats = stats
+	}
+
+	limit := spec.ArtifactLimit
+	if limit == 0 {
+		limit = DefaultArtifactLimit
+	}
+	for _, path := range spec.Outputs {
+		bts, err := cont.readArchive(path, limit)
+		if err != nil {
+			return res, err
+		}
+		res.Artifacts[path] = bts
+	}
+	return res, nil
+}
+
+func (c *Container) runCommand(spec RunSpec, logs io.Writer, res *RunResult) error {
+	if len(spec.Script) != 0 {
+		steps, err := c.RunScript(spec.Script, ScriptOutput(logs))
+		res.Steps = steps
+		if len(steps) != 0 {
+			res.ExitCode = steps[len(steps)-1].ExitCode
+		}
+		return err
+	}
+
+	exec, err := NewExecutionContext(c.options.context, c, spec.Command...)
+	if err != nil {
+		return err
+	}
+	exec.Stdout, exec.Stderr = logs, logs
+	exec.StdoutLimit, exec.StderrLimit = spec.OutputLimit, spec.OutputLimit
+	err = exec.Run()
+	if err == nil {
+		res.ExitCode = exec.ExitStatus().ExitCode
+	}
+	return err
+}
+
+func validateRunInputs(inputs []RunInput) error {
+	for _, input := range inputs {
+		if !path.IsAbs(input.Path) {
+			return errors.Errorf("the path %q of the input must be absolute", input.Path)
+		}
+		if (input.Archive == nil) == (input.HostPath == "") {
+			return errors.Errorf("exactly one of the archive and the host path of the input %v must be set", input.Path)
+		}
+	}
+	return nil
+}
+
+// copyRunInputs extracts the inputs in the deepest existing directory of
+// their path, which lets the daemon create the missing directories before
+// the container is started.
+func (c *Container) copyRunInputs(inputs []RunInput) error {
+	for _, input := range inputs {
+		if err := c.copyRunInput(input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Container) copyRunInput(input RunInput) error {
+	dir, prefix, err := c.existingParent(path.Clean(input.Path))
+	if err != nil {
+		return err
+	}
+	content := input.Archive
+	if input.HostPath != "" {
+		rc, err := hostPathArchive(input.HostPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to archive %v", input.HostPath)
+		}
+		defer rc.Close()
+		content = rc
+	}
+	if prefix != "" {
+		rc := prefixArchive(content, prefix)
+		defer rc.Close()
+		content = rc
+	}
+	return c.CopyToContainer(dir, content)
+}
+
+// prefixArchive returns the tar stream with the slash separated prefix added
+// to the paths of its entries. The prefix directory is created first so that
+// it exists even if the archive is empty.
+func prefixArchive(r io.Reader, prefix string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		tr := tar.NewReader(r)
+		tw := tar.NewWriter(pw)
+		err := tw.WriteHeader(&tar.Header{
+			Name:     prefix + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     0755,
+			ModTime:  time.Now(),
+		})
+		for err == nil {
+			var hdr *tar.Header
+			if hdr, err = tr.Next(); err != nil {
+				break
+			}
+			hdr.Name = path.Join(prefix, hdr.Name)
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Name += "/"
+			}
+			if hdr.Typeflag == tar.TypeLink {
+				hdr.Linkname = path.Join(prefix, hdr.Linkname)
+			}
+			if err = tw.WriteHeader(hdr); err == nil {
+				_, err = io.Copy(tw, tr)
+			}
+		}
+		if err == io.EOF {
+			err = tw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// hostPathArchive returns a tar archive of the file or of the content of the
+// directory
+func hostPathArchive(path string) (io.ReadCloser, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return archive.TarWithOptions(path, &archive.TarOptions{})
+	}
+	return archive.TarWithOptions(filepath.Dir(path), &archive.TarOptions{
+		IncludeFiles: []string{filepath.Base(path)},
+	})
+}
+
+func (c *Container) readArchive(path string, limit int64) ([]byte, error) {
+	rc, err := c.CopyFromContainer(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	bts, err := ioutil.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %v from container", path)
+	}
+	if int64(len(bts)) > limit {
+		return nil, errors.Wrapf(ErrFileTooLarge, "the archive of %v exceeds %d bytes", path, limit)
+	}
+	return bts, nil
+}
+
+func (c *Container) stats() (RunStats, error) {
+	resp, err := c.client.ContainerStats(c.options.context, c.ID, false)
+	if err != nil {
+		return RunStats{}, err
+	}
+	defer resp.Body.Close()
+	var stats types.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return RunStats{}, errors.Wrap(err, "failed to decode container stats")
+	}
+	return RunStats{
+		CPUTime:   time.Duration(stats.CPUStats.CPUUsage.TotalUsage),
+		MaxMemory: stats.MemoryStats.MaxUsage,
+		Pids:      stats.PidsStats.Current,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runDaemon serves a container whose only existing directories are / and
+// /work, whose make command exits with 2 and whose /work/out output is the
+// given archive. The requests changing the container are recorded in order.
+type runDaemon struct {
+	*fakeDaemon
+	mu          sync.Mutex
+	requests    []string
+	extractions []extraction
+}
+
+func (d *runDaemon) record(key string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		d.requests = append(d.requests, key)
+		d.mu.Unlock()
+		handler(w, r)
+	}
+}
+
+func (d *runDaemon) Requests() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.requests...)
+}
+
+func newRunDaemon(t *testing.T, output []byte) (*runDaemon, *Client) {
+	d := &runDaemon{}
+	routes := lifecycleRoutes()
+	for key, route := range execRoutes(map[string]fakeCommand{"make": {Output: "built\n", ExitCode: 2}}) {
+		routes[key] = route
+	}
+	routes["POST /containers/c1/start"] = d.record("start", routes["POST /containers/c1/start"])
+	routes["DELETE /containers/c1"] = d.record("remove", routes["DELETE /containers/c1"])
+	routes["HEAD /containers/c1/archive"] = func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("path") {
+		case "/", "/work":
+			stat, _ := json.Marshal(types.ContainerPathStat{Mode: os.ModeDir | 0755})
+			w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+	routes["PUT /containers/c1/archive"] = d.record("extract", func(w http.ResponseWriter, r *http.Request) {
+		names := archiveNames(t, r.Body)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.extractions = append(d.extractions, extraction{Path: r.URL.Query().Get("path"), Names: names})
+	})
+	routes["GET /containers/c1/archive"] = func(w http.ResponseWriter, r *http.Request) {
+		stat, _ := json.Marshal(types.ContainerPathStat{Name: "out", Mode: os.ModeDir | 0755})
+		w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+		w.Write(output)
+	}
+	routes["GET /containers/c1/stats"] = writeJSON(types.StatsJSON{Stats: types.Stats{
+		CPUStats:    types.CPUStats{CPUUsage: types.CPUUsage{TotalUsage: 1500}},
+		MemoryStats: types.MemoryStats{MaxUsage: 4096},
+		PidsStats:   types.PidsStats{Current: 3},
+	}})
+
+	fake, client := newFakeDaemon(t, routes)
+	d.fakeDaemon = fake
+	return d, client
+}
+
+func runSpec(t *testing.T) RunSpec {
+	return RunSpec{
+		Image:   "alpine",
+		Command: []string{"make"},
+		Inputs: []RunInput{{
+			Path:    "/work/src",
+			Archive: tarArchive(t, &tar.Header{Name: "main.go", Typeflag: tar.TypeReg, Mode: 0644}),
+		}},
+		Outputs: []string{"/work/out"},
+	}
+}
+
+func TestRun(t *testing.T) {
+	output := tarArchive(t, &tar.Header{Name: "out/result", Typeflag: tar.TypeReg, Mode: 0644}).Bytes()
+	d, client := newRunDaemon(t, output)
+	defer d.Close()
+	defer client.Close()
+
+	res, err := client.Run(context.Background(), runSpec(t))
+	require.NoError(t, err)
+	assert.Equal(t, "c1", res.ContainerID)
+	assert.Equal(t, 2, res.ExitCode)
+	assert.Equal(t, "built\n", string(res.Logs))
+	assert.Equal(t, map[string][]byte{"/work/out": output}, res.Artifacts)
+	assert.Equal(t, RunStats{CPUTime: 1500, MaxMemory: 4096, Pids: 3}, res.Stats)
+	assert.False(t, res.FinishedAt.Before(res.StartedAt))
+
+	// the inputs are copied before the container is started, in the deepest
+	// existing directory since the root may be read-only
+	assert.Equal(t, []string{"extract", "start", "remove"}, d.Requests())
+	assert.Equal(t, []extraction{{Path: "/work", Names: []string{"src/", "src/main.go"}}}, d.extractions)
+}
+
+func TestRunArtifactLimit(t *testing.T) {
+	output := tarArchive(t, &tar.Header{Name: "out/result", Typeflag: tar.TypeReg, Mode: 0644}).Bytes()
+	d, client := newRunDaemon(t, output)
+	defer d.Close()
+	defer client.Close()
+
+	spec := runSpec(t)
+	spec.ArtifactLimit = int64(len(output)) - 1
+	res, err := client.Run(context.Background(), spec)
+	assert.Equal(t, ErrFileTooLarge, errors.Cause(err))
+	assert.Equal(t, 2, res.ExitCode)
+	assert.Empty(t, res.Artifacts)
+	assert.Equal(t, 1, d.Calls("DELETE /containers/c1"))
+}
+
+func TestRunInvalidInputs(t *testing.T) {
+	d, client := newRunDaemon(t, nil)
+	defer d.Close()
+	defer client.Close()
+
+	for _, input := range []RunInput{
+		{Path: "", HostPath: "."},
+		{Path: "src", HostPath: "."},
+		{Path: "/src"},
+	} {
+		spec := runSpec(t)
+		spec.Inputs = []RunInput{input}
+		_, err := client.Run(context.Background(), spec)
+		assert.Error(t, err, "input %v", input.Path)
+	}
+	assert.Equal(t, 0, d.Calls("POST /containers/create"))
+}
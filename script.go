@@ -0,0 +1,229 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Step is a command run as part of a script by Container.RunScript.
+type Step struct {
+	// Name identifies the step in events and prefixed output. If Name is the
+	// empty string, Command is used.
+	Name string
+
+	// Command is the command line of the step. It is split into arguments
+	// the same way as NewExecutionFromString does.
+	Command string
+
+	// Env, Dir and User override the container's environment, working
+	// directory and user for the step. See the Execution fields of the same
+	// name.
+	Env  []string
+	Dir  string
+	User string
+
+	// Timeout limits the duration of the step. A zero Timeout only limits
+	// the step by the container's time limit.
+	Timeout time.Duration
+
+	// ContinueOnError allows the script to proceed to the next step if this
+	// step fails.
+	ContinueOnError bool
+
+	// OutputLimit limits the output captured for each stream of the step.
+	OutputLimit OutputLimit
+}
+
+func (s Step) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Command
+}
+
+// StepResult holds the outcome of a step run by Container.RunScript.
+type StepResult struct {
+	Step Step
+
+	// ExitCode is the exit code of the command, or -1 if the command did not
+	// exit on its own
+	ExitCode int
+
+	// Duration is the time spent running the step
+	Duration time.Duration
+
+	// Output holds the combined standard output and error of the step
+	Output []byte
+
+	// Truncated is true if the output exceeded the step's output limit
+	Truncated bool
+
+	// Err is the error returned by the execution, if any
+	Err error
+}
+
+// Failed returns true if the step did not complete successfully
+func (r StepResult) Failed() bool {
+	return r.Err != nil
+}
+
+// StepEventKind is the kind of a StepEvent
+type StepEventKind string
+
+const (
+	// StepStarted is emitted before a step's command is started
+	StepStarted StepEventKind = "started"
+	// StepFinished is emitted after a step's command finished
+	StepFinished StepEventKind = "finished"
+)
+
+// StepEvent describes the progress of a script run by Container.RunScript.
+type StepEvent struct {
+	Kind  StepEventKind
+	Index int
+	Step  Step
+	Time  time.Time
+	// Result is only set for StepFinished events
+	Result *StepResult
+}
+
+type ScriptOptions struct {
+	onEvent func(StepEvent)
+	output  io.Writer
+}
+
+type ScriptOption func(*ScriptOptions)
+
+// OnStepEvent registers a function called when a step starts or finishes.
+func OnStepEvent(f func(StepEvent)) ScriptOption {
+	return func(o *ScriptOptions) {
+		o.onEvent = f
+	}
+}
+
+// ScriptOutput copies the captured output of every step to w as it is
+// produced.
+func ScriptOutput(w io.Writer) ScriptOption {
+	return func(o *ScriptOptions) {
+		o.output = w
+	}
+}
+
+// RunScript runs the steps one after the other and returns the result of
+// every step that was run. The script stops at the first failing step that
+// does not allow the script to continue, in which case the step's error is
+// returned along with the results.
+func (c *Container) RunScript(steps []Step, paramOpts ...ScriptOption) ([]StepResult, error) {
+	opts := &ScriptOptions{}
+	for _, o := range paramOpts {
+		o(opts)
+	}
+	emit := func(ev StepEvent) {
+		if opts.onEvent != nil {
+			opts.onEvent(ev)
+		}
+	}
+
+	results := []StepResult{}
+	for ii, step := range steps {
+		emit(StepEvent{
+			Kind:  StepStarted,
+			Index: ii,
+			Step:  step,
+			Time:  time.Now(),
+		})
+
+		res := c.runStep(step, opts.output)
+		results = append(results, res)
+
+		emit(StepEvent{
+			Kind:   StepFinished,
+			Index:  ii,
+			Step:   step,
+			Time:   time.Now(),
+			Result: &res,
+		})
+
+		if res.Failed() && !step.ContinueOnError {
+			return results, errors.Wrapf(res.Err, "step %d (%s) failed", ii, step.name())
+		}
+	}
+	return results, nil
+}
+
+func (c *Container) runStep(step Step, output io.Writer) (res StepResult) {
+	res = StepResult{
+		Step:     step,
+		ExitCode: -1,
+	}
+
+	var ctx context.Context = c.options.context
+	if step.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, step.Timeout)
+		defer cancel()
+	}
+
+	// the result is named so that the deferred function sets its duration
+	start := time.Now()
+	defer func() {
+		res.Duration = time.Since(start)
+	}()
+
+	exec, err := NewExecutionFromStringContext(ctx, c, step.Command)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	exec.Name = step.name()
+	exec.Env = step.Env
+	exec.Dir = step.Dir
+	exec.User = step.User
+	exec.StdoutLimit = step.OutputLimit
+	exec.StderrLimit = step.OutputLimit
+	// a failed command fails the step
+	exec.ExitErrors = true
+
+	buf := &lockedBuffer{}
+	var out io.Writer = buf
+	if output != nil {
+		out = io.MultiWriter(buf, output)
+	}
+	exec.Stdout, exec.Stderr = out, out
+
+	res.Err = exec.Run()
+	res.Output = buf.Bytes()
+
+	status := exec.ExitStatus()
+	res.Truncated = len(status.LimitExceeded) != 0
+	if ee, ok := errors.Cause(res.Err).(*ExitError); ok {
+		res.ExitCode = ee.ExitCode
+	} else if res.Err == nil {
+		res.ExitCode = status.ExitCode
+	}
+	return res
+}
+
+// lockedBuffer is a bytes.Buffer that is safe to write to from the stdout
+// and stderr copies of an execution.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Bytes()
+}
@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testScriptContainer(t *testing.T, commands map[string]fakeCommand) (*Container, func()) {
+	d, client := newFakeDaemon(t, execRoutes(commands))
+	opts := NewContainerOptions(client)
+	cont := &Container{ID: "c1", client: client, options: *opts}
+	return cont, func() {
+		opts.cancelFunc()
+		client.Close()
+		d.Close()
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	cont, cleanup := testScriptContainer(t, map[string]fakeCommand{
+		"make":       {Output: "built\n", Delay: 50 * time.Millisecond},
+		"make test":  {Output: "1 failed\n", ExitCode: 2},
+		"make check": {Output: "ok\n"},
+	})
+	defer cleanup()
+
+	events := []StepEventKind{}
+	results, err := cont.RunScript([]Step{
+		{Command: "make"},
+		{Command: "make test"},
+		{Command: "make check"},
+	}, OnStepEvent(func(ev StepEvent) {
+		events = append(events, ev.Kind)
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "step 1 (make test) failed")
+	require.Len(t, results, 2)
+	assert.Equal(t, []StepEventKind{StepStarted, StepFinished, StepStarted, StepFinished}, events)
+
+	assert.False(t, results[0].Failed())
+	assert.Equal(t, 0, results[0].ExitCode)
+	assert.Equal(t, "built\n", string(results[0].Output))
+	assert.True(t, results[0].Duration >= 50*time.Millisecond)
+
+	assert.True(t, results[1].Failed())
+	assert.Equal(t, 2, results[1].ExitCode)
+	assert.True(t, results[1].Duration > 0)
+}
+
+func TestRunScriptContinueOnError(t *testing.T) {
+	cont, cleanup := testScriptContainer(t, map[string]fakeCommand{
+		"lint":  {ExitCode: 1},
+		"build": {Output: strings.Repeat("x", 100)},
+	})
+	defer cleanup()
+
+	results, err := cont.RunScript([]Step{
+		{Name: "lint", Command: "lint", ContinueOnError: true},
+		{Command: "build", OutputLimit: OutputLimit{Bytes: 10}},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	assert.True(t, results[0].Failed())
+	assert.Equal(t, 1, results[0].ExitCode)
+
+	assert.False(t, results[1].Failed())
+	assert.True(t, results[1].Truncated)
+	assert.True(t, strings.HasPrefix(string(results[1].Output), strings.Repeat("x", 10)+"\n"))
+}
@@ -0,0 +1,184 @@
+package docker
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SeccompUnconfined disables seccomp filtering when used as the seccomp
+	// profile of a SecurityConfig
+	SeccompUnconfined = "unconfined"
+	// SeccompDefault uses the seccomp profile embedded in the package, which
+	// is the default profile of docker 18.09, whatever the default profile
+	// of the daemon is
+	SeccompDefault = "default"
+)
+
+// defaultSeccompProfile is copied from the profiles/seccomp package of
+// github.com/docker/docker
+//
+//go:embed seccomp_default.json
+var defaultSeccompProfile []byte
+
+// SecurityConfig describes how a container is isolated from the host. Unlike
+// the default options, a security configuration is never privileged, since
+// privileged containers ignore the dropped capabilities, seccomp and AppArmor.
+type SecurityConfig struct {
+	// CapAdd and CapDrop are the capabilities added to and dropped from the
+	// default set of the daemon. ALL drops every capability.
+	CapAdd  []string
+	CapDrop []string
+	// Seccomp is the path of a seccomp profile on the host, SeccompDefault or
+	// SeccompUnconfined. The default profile of the daemon is used when empty.
+	Seccomp string
+	// AppArmorProfile is the name of an AppArmor profile loaded on the host.
+	// The daemon uses docker-default when empty.
+	AppArmorProfile string
+	// SELinuxLabels are the SELinux options, such as type:container_t or
+	// level:s0:c100,c200
+	SELinuxLabels []string
+	// NoNewPrivileges prevents the processes from gaining privileges through
+	// setuid binaries or file capabilities
+	NoNewPrivileges bool
+	// ReadonlyRootfs mounts the root file system read only. Files cannot be
+	// copied into tmpfs mounts, so the directories the inputs are copied to
+	// should be volumes (see AddVolume).
+	ReadonlyRootfs bool
+	// Tmpfs are the writable tmpfs mounts indexed by path, with their mount
+	// options such as rw,noexec,size=64m
+	Tmpfs map[string]string
+}
+
+// SecurityPresets are the named security configurations usable with
+// SecurityPreset and the docker.security_profile configuration
+var SecurityPresets = map[string]SecurityConfig{
+	// untrusted-student runs code submitted by users with no capabilities
+	// and a read only root file system
+	"untrusted-student": {
+		CapDrop:         []string{"ALL"},
+		Seccomp:         SeccompDefault,
+		NoNewPrivileges: true,
+		ReadonlyRootfs:  true,
+		Tmpfs: map[string]string{
+			"/tmp": "rw,nosuid,nodev,size=1g",
+			"/run": "rw,noexec,nosuid,nodev,size=64m",
+		},
+	},
+	// trusted-build runs build scripts that may install packages, so the
+	// root file system is writable and the file capabilities are kept
+	"trusted-build": {
+		CapDrop: []string{
+			"net_raw",
+			"mknod",
+			"audit_write",
+			"sys_chroot",
+			"setfcap",
+		},
+	},
+}
+
+// SecurityProfile runs the container unprivileged with the security
+// configuration, replacing the capabilities, seccomp, AppArmor, SELinux and
+// no-new-privileges settings of the previous options. NewContainer fails if
+// the seccomp profile cannot be read.
+func SecurityProfile(cfg SecurityConfig) ContainerOption {
+	return func(o *ContainerOptions) {
+		seccomp, err := seccompSecurityOpt(cfg.Seccomp)
+		if err != nil {
+			o.setError(err)
+			return
+		}
+
+		h := o.hostConfig
+		h.Privileged = false
+		h.CapAdd = strslice.StrSlice(append([]string{}, cfg.CapAdd...))
+		h.CapDrop = strslice.StrSlice(append([]string{}, cfg.CapDrop...))
+		h.ReadonlyRootfs = cfg.ReadonlyRootfs
+		if len(cfg.Tmpfs) != 0 && h.Tmpfs == nil {
+			h.Tmpfs = map[string]string{}
+		}
+		for path, mountOpts := range cfg.Tmpfs {
+			h.Tmpfs[path] = mountOpts
+		}
+
+		securityOpt := []string{}
+		for _, opt := range h.SecurityOpt {
+			if !isProfileSecurityOpt(opt) {
+				securityOpt = append(securityOpt, opt)
+			}
+		}
+		if seccomp != "" {
+			securityOpt = append(securityOpt, seccomp)
+		}
+		if cfg.AppArmorProfile != "" {
+			securityOpt = append(securityOpt, "apparmor="+cfg.AppArmorProfile)
+		}
+		for _, label := range cfg.SELinuxLabels {
+			securityOpt = append(securityOpt, "label="+label)
+		}
+		if cfg.NoNewPrivileges {
+			securityOpt = append(securityOpt, "no-new-privileges")
+		}
+		h.SecurityOpt = securityOpt
+	}
+}
+
+// SecurityPreset applies the named security configuration of SecurityPresets.
+// NewContainer fails for unknown names, so that a typo does not leave the
+// container privileged.
+func SecurityPreset(name string) ContainerOption {
+	cfg, ok := SecurityPresets[name]
+	if !ok {
+		return func(o *ContainerOptions) {
+			o.setError(errors.Errorf("unknown security preset %v", name))
+		}
+	}
+	return SecurityProfile(cfg)
+}
+
+// isProfileSecurityOpt returns true for the security options set by
+// SecurityProfile
+func isProfileSecurityOpt(opt string) bool {
+	key := strings.FieldsFunc(opt, func(r rune) bool {
+		return r == '=' || r == ':'
+	})
+	if len(key) == 0 {
+		return false
+	}
+	switch key[0] {
+	case "seccomp", "apparmor", "label", "no-new-privileges":
+		return true
+	}
+	return false
+}
+
+// seccompSecurityOpt returns the security option of the seccomp profile, or
+// an empty option for the default profile of the daemon. The daemon expects
+// the content of the profile rather than its path.
+func seccompSecurityOpt(profile string) (string, error) {
+	if profile == "" {
+		return "", nil
+	}
+	if profile == SeccompUnconfined {
+		return "seccomp=" + SeccompUnconfined, nil
+	}
+	bts := defaultSeccompProfile
+	if profile != SeccompDefault {
+		var err error
+		if bts, err = ioutil.ReadFile(profile); err != nil {
+			return "", errors.Wrapf(err, "failed to read seccomp profile %v", profile)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := json.Compact(buf, bts); err != nil {
+		return "", errors.Wrapf(err, "failed to parse seccomp profile %v", profile)
+	}
+	return "seccomp=" + buf.String(), nil
+}
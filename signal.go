@@ -0,0 +1,193 @@
+package docker
+
+import (
+	"os"
+	gosignal "os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/pkg/signal"
+	"github.com/pkg/errors"
+)
+
+var (
+	signalNamesOnce sync.Once
+	signalNames     map[os.Signal]string
+)
+
+// signalName returns the name of the signal as understood by the daemon
+func signalName(s os.Signal) string {
+	signalNamesOnce.Do(func() {
+		signalNames = make(map[os.Signal]string, len(signal.SignalMap))
+		for name, sig := range signal.SignalMap {
+			// some signals have several names, keep a deterministic one
+			if prev, ok := signalNames[sig]; ok && prev < name {
+				continue
+			}
+			signalNames[sig] = name
+		}
+	})
+	return signalNames[s]
+}
+
+type SignalForwardOptions struct {
+	execution    *Execution
+	allow        map[os.Signal]bool
+	deny         map[os.Signal]bool
+	gracefulStop bool
+	gracePeriod  time.Duration
+}
+
+type SignalForwardOption func(*SignalForwardOptions)
+
+// ForwardToExecution forwards the signals to the process tree of the
+// execution instead of the container's main process.
+func ForwardToExecution(e *Execution) SignalForwardOption {
+	return func(o *SignalForwardOptions) {
+		o.execution = e
+	}
+}
+
+// ForwardOnly only forwards the given signals.
+func ForwardOnly(sigs ...os.Signal) SignalForwardOption {
+	return func(o *SignalForwardOptions) {
+		if o.allow == nil {
+			o.allow = map[os.Signal]bool{}
+		}
+		for _, s := range sigs {
+			o.allow[s] = true
+		}
+	}
+}
+
+// ForwardExcept does not forward the given signals.
+func ForwardExcept(sigs ...os.Signal) SignalForwardOption {
+	return func(o *SignalForwardOptions) {
+		for _, s := range sigs {
+			o.deny[s] = true
+		}
+	}
+}
+
+// ForwardGracefulStop stops the container instead of forwarding SIGINT and
+// SIGTERM. The container is sent SIGTERM and is killed if it is still
+// running after the grace period.
+func ForwardGracefulStop(gracePeriod time.Duration) SignalForwardOption {
+	return func(o *SignalForwardOptions) {
+		o.gracefulStop = true
+		o.gracePeriod = gracePeriod
+	}
+}
+
+// ForwardAllSignals forwards the signals received by the current process to
+// the container. SIGCHLD, SIGPIPE and SIGURG, which concern the current
+// process only, are never forwarded. The signals that are not forwarded keep
+// their default handling. The returned function stops forwarding and restores
+// the default signal handling.
+func (c *Container) ForwardAllSignals(paramOpts ...SignalForwardOption) func() {
+	opts := newSignalForwardOptions(paramOpts...)
+
+	sigc := make(chan os.Signal, 128)
+	gosignal.Notify(sigc, opts.signals()...)
+	done := make(chan struct{})
+	var stopping sync.Once
+
+	go func() {
+		for {
+			var s os.Signal
+			select {
+			case <-done:
+				return
+			case s = <-sigc:
+			}
+			if opts.gracefulStop && (s == syscall.SIGINT || s == syscall.SIGTERM) {
+				stopping.Do(func() {
+					go func() {
+						if err := c.gracefulStop(opts.gracePeriod); err != nil {
+							log.WithError(err).WithField("container_id", c.ID).Error("failed to stop container")
+						}
+					}()
+				})
+				continue
+			}
+			if err := c.forwardSignal(s, opts.execution); err != nil {
+				log.WithError(err).Debug("sending signal")
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			gosignal.Stop(sigc)
+			close(done)
+		})
+	}
+}
+
+func newSignalForwardOptions(paramOpts ...SignalForwardOption) *SignalForwardOptions {
+	opts := &SignalForwardOptions{
+		deny: map[os.Signal]bool{},
+	}
+	opts.deny[signal.SIGCHLD] = true
+	opts.deny[signal.SIGPIPE] = true
+	// the go runtime uses SIGURG to preempt goroutines
+	if urg, ok := signal.SignalMap["URG"]; ok {
+		opts.deny[urg] = true
+	}
+	for _, o := range paramOpts {
+		o(opts)
+	}
+	return opts
+}
+
+// signals returns the signals to forward, sorted by value. Only these are
+// caught, so that the other ones keep their default handling.
+func (o *SignalForwardOptions) signals() []os.Signal {
+	candidates := o.allow
+	if candidates == nil {
+		candidates = map[os.Signal]bool{}
+		for _, s := range signal.SignalMap {
+			candidates[s] = true
+		}
+	}
+	res := []os.Signal{}
+	for s := range candidates {
+		if !o.deny[s] {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(ii, jj int) bool {
+		return signalNumber(res[ii]) < signalNumber(res[jj])
+	})
+	return res
+}
+
+func signalNumber(s os.Signal) int {
+	if n, ok := s.(syscall.Signal); ok {
+		return int(n)
+	}
+	return -1
+}
+
+func (c *Container) forwardSignal(s os.Signal, e *Execution) error {
+	if e != nil {
+		return e.Signal(s)
+	}
+	name := signalName(s)
+	if name == "" {
+		return errors.Errorf("unsupported signal %v", s)
+	}
+	return c.killWithSignal(name)
+}
+
+// gracefulStop sends SIGTERM to the container and stops it once it exited or
+// the grace period elapsed.
+func (c *Container) gracefulStop(gracePeriod time.Duration) error {
+	return c.StopWithOptions(
+		StopWithSignal("SIGTERM"),
+		StopGracePeriod(gracePeriod),
+	)
+}
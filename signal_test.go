@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/docker/docker/pkg/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalName(t *testing.T) {
+	assert.Equal(t, "TERM", signalName(syscall.SIGTERM))
+	assert.Equal(t, "INT", signalName(os.Interrupt))
+	assert.Equal(t, "HUP", signalName(syscall.SIGHUP))
+	// SIGIOT is an alias of SIGABRT
+	assert.Equal(t, "ABRT", signalName(syscall.SIGABRT))
+	assert.Equal(t, "", signalName(syscall.Signal(1000)))
+}
+
+func forwardedSignals(paramOpts ...SignalForwardOption) []os.Signal {
+	return newSignalForwardOptions(paramOpts...).signals()
+}
+
+func TestForwardedSignals(t *testing.T) {
+	all := forwardedSignals()
+	assert.Contains(t, all, os.Signal(syscall.SIGTERM))
+	assert.Contains(t, all, os.Signal(syscall.SIGINT))
+	assert.NotContains(t, all, os.Signal(signal.SIGCHLD))
+	assert.NotContains(t, all, os.Signal(signal.SIGPIPE))
+	assert.NotContains(t, all, signal.SignalMap["URG"])
+
+	except := forwardedSignals(ForwardExcept(os.Interrupt))
+	assert.NotContains(t, except, os.Signal(syscall.SIGINT))
+	assert.Contains(t, except, os.Signal(syscall.SIGTERM))
+
+	only := forwardedSignals(
+		ForwardOnly(syscall.SIGTERM, syscall.SIGHUP, syscall.SIGINT),
+		ForwardExcept(syscall.SIGHUP),
+	)
+	assert.Equal(t, []os.Signal{syscall.SIGINT, syscall.SIGTERM}, only)
+}
@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/imdario/mergo"
+	"github.com/pkg/errors"
+)
+
+// ContainerState is the state of a container as reported by the daemon
+type ContainerState string
+
+const (
+	StateCreated    ContainerState = "created"
+	StateRunning    ContainerState = "running"
+	StatePaused     ContainerState = "paused"
+	StateRestarting ContainerState = "restarting"
+	StateRemoving   ContainerState = "removing"
+	StateExited     ContainerState = "exited"
+	StateDead       ContainerState = "dead"
+	// StateRemoved is reported once the container no longer exists
+	StateRemoved ContainerState = "removed"
+)
+
+// IsActive returns true if the main process of the container is alive
+func (s ContainerState) IsActive() bool {
+	return s == StateRunning || s == StatePaused || s == StateRestarting
+}
+
+// State inspects the container and returns its current state. The state
+// tracked by the container is updated, which accounts for changes made
+// outside of this package.
+func (c *Container) State() (ContainerState, error) {
+	return c.refreshState(c.options.parentCtx)
+}
+
+func (c *Container) refreshState(ctx context.Context) (ContainerState, error) {
+	info, err := c.client.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			c.setState(StateRemoved)
+			return StateRemoved, nil
+		}
+		return c.getState(), errors.Wrapf(err, "failed to inspect container %v", c.ID)
+	}
+	state := StateCreated
+	if info.State != nil {
+		state = ContainerState(info.State.Status)
+	}
+	c.setState(state)
+	return state, nil
+}
+
+func (c *Container) getState() ContainerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// setState records the state of the container. The time limit of the
+// container is only consumed while it is not paused.
+func (c *Container) setState(s ContainerState) {
+	c.mu.Lock()
+	prev := c.state
+	c.state = s
+	c.mu.Unlock()
+	if s == StatePaused {
+		c.options.context.pause()
+	} else {
+		c.options.context.resume()
+	}
+	if s != prev {
+		c.journalState(s)
+	}
+}
+
+// Remaining returns the part of the time limit of the container that was not
+// used yet. The time spent paused is not counted.
+func (c *Container) Remaining() time.Duration {
+	return c.options.context.Remaining()
+}
+
+// Pause freezes the processes of the container. The time limit of the
+// container does not elapse while it is paused.
+func (c *Container) Pause() error {
+	if err := c.client.ContainerPause(c.options.context, c.ID); err != nil {
+		return errors.Wrapf(err, "failed to pause container %v", c.ID)
+	}
+	c.setState(StatePaused)
+	return nil
+}
+
+// Unpause resumes the processes of a paused container.
+func (c *Container) Unpause() error {
+	// the time limit is not running while the container is paused, so the
+	// context of the container can not expire
+	if err := c.client.ContainerUnpause(c.options.parentCtx, c.ID); err != nil {
+		return errors.Wrapf(err, "failed to unpause container %v", c.ID)
+	}
+	c.setState(StateRunning)
+	return nil
+}
+
+// Restart stops the container, killing it if it is still running after the
+// timeout, and starts it again.
+func (c *Container) Restart(timeout time.Duration) error {
+	if err := c.client.ContainerRestart(c.options.context, c.ID, &timeout); err != nil {
+		return errors.Wrapf(err, "failed to restart container %v", c.ID)
+	}
+	c.setState(StateRunning)
+	c.emit(LifecycleEvent{Type: ContainerStarted})
+	return nil
+}
+
+// Rename changes the name of the container.
+func (c *Container) Rename(name string) error {
+	if err := c.client.ContainerRename(c.options.context, c.ID, name); err != nil {
+		return errors.Wrapf(err, "failed to rename container %v to %v", c.ID, name)
+	}
+	c.options.name = name
+	return nil
+}
+
+// Update changes the resources of the container. Only the non-zero fields of
+// the resources are updated.
+func (c *Container) Update(resources container.Resources) error {
+	resp, err := c.client.ContainerUpdate(c.options.context, c.ID, container.UpdateConfig{
+		Resources: resources,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to update container %v", c.ID)
+	}
+	for _, warning := range resp.Warnings {
+		log.WithField("container_id", c.ID).Warn(warning)
+	}
+	if err := mergo.Merge(&c.options.hostConfig.Resources, resources, mergo.WithOverride); err != nil {
+		log.WithError(err).WithField("container_id", c.ID).Debug("failed to record the updated resources")
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+)
+
+// containerRemoveTimeout bounds the daemon calls made while stopping a
+// container on top of the grace period
+const containerRemoveTimeout = time.Minute
+
+// preStopTimeout bounds the pre-stop hook
+const preStopTimeout = time.Minute
+
+type StopOptions struct {
+	signal        string
+	gracePeriod   time.Duration
+	remove        bool
+	removeVolumes bool
+	preStop       func(*Container) error
+}
+
+type StopOption func(*StopOptions)
+
+// StopWithSignal overrides the signal sent to the container's main process.
+// By default, the stop signal of the container is used, which is the one of
+// its image or SIGTERM unless set with the StopSignal option.
+func StopWithSignal(sig string) StopOption {
+	return func(o *StopOptions) {
+		o.signal = sig
+	}
+}
+
+// StopGracePeriod sets the time the container is given to exit after
+// receiving the stop signal before it is killed.
+func StopGracePeriod(d time.Duration) StopOption {
+	return func(o *StopOptions) {
+		o.gracePeriod = d
+	}
+}
+
+// StopRemove controls whether the container is removed once stopped. It
+// defaults to true.
+func StopRemove(b bool) StopOption {
+	return func(o *StopOptions) {
+		o.remove = b
+	}
+}
+
+// StopKeepVolumes keeps the anonymous volumes of the container when it is
+// removed.
+func StopKeepVolumes(b bool) StopOption {
+	return func(o *StopOptions) {
+		o.removeVolumes = !b
+	}
+}
+
+// PreStop registers a function called before the container is signaled, for
+// example to copy results out of the container. An error returned by the
+// function is reported but does not prevent the container from stopping. The
+// function is given a handle to the container bound to a fresh context, so
+// that its operations and executions also run once the time limit of the
+// container is exceeded.
+func PreStop(f func(*Container) error) StopOption {
+	return func(o *StopOptions) {
+		o.preStop = f
+	}
+}
+
+func NewStopOptions(c *Container, opts ...StopOption) *StopOptions {
+	res := &StopOptions{
+		signal:        c.options.containerConfig.StopSignal,
+		gracePeriod:   Config.StopGracePeriod,
+		remove:        true,
+		removeVolumes: true,
+	}
+	for _, o := range opts {
+		o(res)
+	}
+	return res
+}
+
+// StopError aggregates the errors encountered while stopping a container.
+type StopError struct {
+	ContainerID string
+	Errors      []error
+}
+
+func (e *StopError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for ii, err := range e.Errors {
+		msgs[ii] = err.Error()
+	}
+	return "failed to stop container " + e.ContainerID + ": " + strings.Join(msgs, "; ")
+}
+
+// StopWithOptions stops the container. The pre-stop hook is run first, the
+// stop signal is then sent to the container which is killed if it did not
+// exit within the grace period. Finally, the container is removed. Every step
+// is attempted even if a previous one failed, and the failures are returned as
+// a *StopError.
+func (c *Container) StopWithOptions(paramOpts ...StopOption) error {
+	opts := NewStopOptions(c, paramOpts...)
+
+	defer func() {
+		c.options.cancelFunc()
+		if c.cancelEvents != nil {
+			c.cancelEvents()
+		}
+	}()
+
+	// the options context is likely done if the time limit was exceeded
+	ctx, cancel := context.WithTimeout(context.Background(), opts.gracePeriod+containerRemoveTimeout)
+	defer cancel()
+
+	// the container may have been started or stopped outside of this package
+	state, err := c.refreshState(ctx)
+	if err != nil {
+		log.WithError(err).WithField("container_id", c.ID).Debug("failed to refresh the container state")
+	}
+
+	errs := []error{}
+	if state == StatePaused {
+		if err := c.client.ContainerUnpause(ctx, c.ID); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to unpause container"))
+		}
+	}
+
+	if state.IsActive() && opts.preStop != nil {
+		if err := c.runPreStop(opts.preStop); err != nil {
+			errs = append(errs, errors.Wrap(err, "pre-stop hook failed"))
+		}
+	}
+
+	c.releaseGPUs()
+
+	if state.IsActive() {
+		if err := c.signalAndWait(ctx, opts.signal, opts.gracePeriod); err != nil {
+			errs = append(errs, err)
+		} else {
+			c.setState(StateExited)
+			c.emit(LifecycleEvent{Type: ContainerStopped})
+		}
+	}
+
+	if opts.remove {
+		if err := c.remove(ctx, opts.removeVolumes); err != nil && !errdefs.IsNotFound(err) {
+			errs = append(errs, errors.Wrap(err, "failed to remove container"))
+		} else {
+			c.setState(StateRemoved)
+			c.emit(LifecycleEvent{Type: ContainerRemoved})
+		}
+	}
+
+	if len(errs) != 0 {
+		return &StopError{ContainerID: c.ID, Errors: errs}
+	}
+	return nil
+}
+
+// runPreStop calls the hook with a handle to the container bound to a fresh
+// context, since the context of the container is done once its time limit is
+// exceeded
+func (c *Container) runPreStop(hook func(*Container) error) error {
+	ctx, cancel := withTimelimit(context.Background(), preStopTimeout)
+	defer cancel()
+	return hook(c.withContext(ctx))
+}
+
+// withContext returns a handle to the container whose operations and
+// executions are bound to ctx. The options of the container are shared by
+// concurrent operations, so they are copied rather than modified.
+func (c *Container) withContext(ctx *timelimitContext) *Container {
+	opts := c.options
+	opts.parentCtx = ctx
+	opts.context = ctx
+	return &Container{
+		ID:      c.ID,
+		client:  c.client,
+		options: opts,
+		state:   c.getState(),
+	}
+}
+
+// signalAndWait sends sig to the container and kills it if it is still
+// running after the grace period. If sig is empty, the daemon sends the stop
+// signal of the container.
+func (c *Container) signalAndWait(ctx context.Context, sig string, gracePeriod time.Duration) error {
+	client := c.client
+	if sig == "" {
+		err := client.ContainerStop(ctx, c.ID, &gracePeriod)
+		if err == nil || errdefs.IsNotFound(err) {
+			return nil
+		}
+		log.WithError(err).WithField("container_id", c.ID).Debug("failed to stop container")
+	} else if sig != "SIGKILL" && sig != "KILL" && sig != "9" {
+		if err := client.ContainerKill(ctx, c.ID, sig); err != nil {
+			if errdefs.IsConflict(err) || errdefs.IsNotFound(err) {
+				// the container is not running
+				return nil
+			}
+			log.WithError(err).WithField("container_id", c.ID).Debug("failed to send stop signal")
+		} else {
+			waitCtx, cancel := context.WithTimeout(ctx, gracePeriod)
+			defer cancel()
+			waitc, errc := client.ContainerWait(waitCtx, c.ID, container.WaitConditionNotRunning)
+			select {
+			case <-waitc:
+				return nil
+			case <-errc:
+			}
+		}
+	}
+	err := client.ContainerKill(ctx, c.ID, "SIGKILL")
+	if err != nil && !errdefs.IsConflict(err) && !errdefs.IsNotFound(err) {
+		return errors.Wrap(err, "failed to kill container")
+	}
+	return nil
+}
+
+func (c *Container) remove(ctx context.Context, removeVolumes bool) error {
+	client := c.client
+	err := client.ContainerRemove(
+		ctx,
+		c.ID,
+		types.ContainerRemoveOptions{
+			RemoveVolumes: removeVolumes,
+			// RemoveLinks:   true,
+			Force: true,
+		},
+	)
+	return err
+}
@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stopRoutes(killed *[]string) map[string]http.HandlerFunc {
+	noContent := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return map[string]http.HandlerFunc{
+		"GET /containers/c1/json": writeJSON(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{
+				ID:    "c1",
+				State: &types.ContainerState{Status: "running", Running: true},
+			},
+		}),
+		"POST /containers/c1/stop": noContent,
+		"POST /containers/c1/kill": func(w http.ResponseWriter, r *http.Request) {
+			*killed = append(*killed, r.URL.Query().Get("signal"))
+			noContent(w, r)
+		},
+		"POST /containers/c1/wait": writeJSON(container.ContainerWaitOKBody{}),
+		"DELETE /containers/c1":    noContent,
+	}
+}
+
+func TestStopDefaultSignal(t *testing.T) {
+	killed := []string{}
+	d, client := newFakeDaemon(t, stopRoutes(&killed))
+	defer d.Close()
+	defer client.Close()
+
+	opts := NewContainerOptions(client, Timelimit(time.Millisecond))
+	cont := &Container{ID: "c1", client: client, options: *opts, state: StateRunning}
+	<-opts.context.Done()
+
+	var hookErr error
+	err := cont.StopWithOptions(
+		StopGracePeriod(10*time.Second),
+		PreStop(func(c *Container) error {
+			assert.NotEqual(t, cont, c)
+			hookErr = c.options.context.Err()
+			// the container context is left alone for its other users
+			assert.Equal(t, context.DeadlineExceeded, cont.options.context.Err())
+			_, err := c.State()
+			return err
+		}),
+	)
+	require.NoError(t, err)
+	assert.NoError(t, hookErr)
+	assert.Equal(t, 1, d.Calls("POST /containers/c1/stop"))
+	assert.Empty(t, killed)
+	assert.Equal(t, StateRemoved, cont.getState())
+	assert.Equal(t, opts.context, cont.options.context)
+}
+
+func TestStopWithSignal(t *testing.T) {
+	killed := []string{}
+	d, client := newFakeDaemon(t, stopRoutes(&killed))
+	defer d.Close()
+	defer client.Close()
+
+	opts := NewContainerOptions(client, StopSignal("SIGINT"))
+	cont := &Container{ID: "c1", client: client, options: *opts, state: StateRunning}
+	require.NoError(t, cont.Stop())
+	assert.Equal(t, 0, d.Calls("POST /containers/c1/stop"))
+	assert.Equal(t, []string{"SIGINT"}, killed)
+}
+
+func TestStopPreStopConcurrentReaders(t *testing.T) {
+	killed := []string{}
+	d, client := newFakeDaemon(t, stopRoutes(&killed))
+	defer d.Close()
+	defer client.Close()
+
+	opts := NewContainerOptions(client)
+	cont := &Container{ID: "c1", client: client, options: *opts, state: StateRunning}
+
+	// the container is used while the pre-stop hook runs
+	done := make(chan struct{})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				cont.Remaining()
+				NewExecution(cont, "true")
+			}
+		}
+	}()
+	err := cont.StopWithOptions(PreStop(func(c *Container) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}))
+	close(done)
+	<-read
+	require.NoError(t, err)
+}
@@ -5,13 +5,16 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"sync"
 
 	"github.com/docker/docker/pkg/term"
 )
 
 // OutStream is an output stream used by the DockerCli to write normal program
-// output.
+// output. Each write is forwarded to the underlying writer in one piece, so an
+// OutStream is safe to use from concurrent writers.
 type OutStream struct {
+	mu         sync.Mutex
 	out        io.Writer
 	fd         uintptr
 	isTerminal bool
@@ -19,6 +22,8 @@ type OutStream struct {
 }
 
 func (o *OutStream) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	return o.out.Write(p)
 }
 
@@ -145,20 +150,39 @@ type stream struct {
 	stdin  io.ReadCloser
 	stdout io.Writer
 	stderr io.Writer
+
+	// in and out are created once so that the terminal state saved when
+	// setting raw mode is available when restoring the terminal
+	in  *InStream
+	out *OutStream
 }
 
 func (s *stream) In() *InStream {
 	if s.stdin == nil {
 		return nil
 	}
-	return NewInStream(s.stdin)
+	if s.in == nil {
+		if in, ok := s.stdin.(*InStream); ok {
+			s.in = in
+		} else {
+			s.in = NewInStream(s.stdin)
+		}
+	}
+	return s.in
 }
 
 func (s *stream) Out() *OutStream {
 	if s.stdout == nil {
 		return nil
 	}
-	return NewOutStream(s.stdout)
+	if s.out == nil {
+		if out, ok := s.stdout.(*OutStream); ok {
+			s.out = out
+		} else {
+			s.out = NewOutStream(s.stdout)
+		}
+	}
+	return s.out
 }
 
 func (s *stream) Err() io.Writer {
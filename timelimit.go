@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// timelimitContext is a context that expires once it was running for longer
+// than its budget. The time spent paused is not counted against the budget.
+type timelimitContext struct {
+	context.Context
+	mu        sync.Mutex
+	done      chan struct{}
+	err       error
+	remaining time.Duration
+	resumedAt time.Time
+	timer     *time.Timer
+	// generation is incremented whenever the context is paused so that a
+	// timer which fired while being stopped does not expire the context
+	generation int
+}
+
+// withTimelimit returns a running context derived from parent that expires
+// after the time limit.
+func withTimelimit(parent context.Context, limit time.Duration) (*timelimitContext, context.CancelFunc) {
+	ctx := &timelimitContext{
+		Context:   parent,
+		done:      make(chan struct{}),
+		remaining: limit,
+	}
+	ctx.resume()
+	go func() {
+		select {
+		case <-parent.Done():
+			ctx.cancel(parent.Err())
+		case <-ctx.done:
+		}
+	}()
+	return ctx, func() { ctx.cancel(context.Canceled) }
+}
+
+// Deadline returns the time the context expires at if it is not paused in
+// the meantime. There is no deadline while the context is paused.
+func (ctx *timelimitContext) Deadline() (time.Time, bool) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.resumedAt.IsZero() || ctx.err != nil {
+		return time.Time{}, false
+	}
+	deadline := ctx.resumedAt.Add(ctx.remaining)
+	if parent, ok := ctx.Context.Deadline(); ok && parent.Before(deadline) {
+		return parent, true
+	}
+	return deadline, true
+}
+
+func (ctx *timelimitContext) Done() <-chan struct{} {
+	return ctx.done
+}
+
+func (ctx *timelimitContext) Err() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.err
+}
+
+// Remaining returns the part of the time limit that was not used yet
+func (ctx *timelimitContext) Remaining() time.Duration {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	remaining := ctx.remaining
+	if !ctx.resumedAt.IsZero() {
+		remaining -= time.Since(ctx.resumedAt)
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// pause stops counting time against the time limit. It is a no-op if the
+// context is already paused or done.
+func (ctx *timelimitContext) pause() {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.resumedAt.IsZero() || ctx.err != nil {
+		return
+	}
+	ctx.timer.Stop()
+	ctx.generation++
+	ctx.remaining -= time.Since(ctx.resumedAt)
+	ctx.resumedAt = time.Time{}
+}
+
+// resume starts counting time against the time limit again. It is a no-op if
+// the context is running or done.
+func (ctx *timelimitContext) resume() {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if !ctx.resumedAt.IsZero() || ctx.err != nil {
+		return
+	}
+	ctx.resumedAt = time.Now()
+	generation := ctx.generation
+	ctx.timer = time.AfterFunc(ctx.remaining, func() {
+		ctx.expire(generation)
+	})
+}
+
+// expire cancels the context if it was not paused since the timer of the
+// generation was started
+func (ctx *timelimitContext) expire(generation int) {
+	ctx.mu.Lock()
+	stale := generation != ctx.generation
+	ctx.mu.Unlock()
+	if !stale {
+		ctx.cancel(context.DeadlineExceeded)
+	}
+}
+
+func (ctx *timelimitContext) cancel(err error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	if ctx.err != nil {
+		return
+	}
+	ctx.err = err
+	if ctx.timer != nil {
+		ctx.timer.Stop()
+	}
+	close(ctx.done)
+}
@@ -0,0 +1,81 @@
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimelimitExpires(t *testing.T) {
+	ctx, cancel := withTimelimit(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, ok := ctx.Deadline()
+	assert.True(t, ok)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the time limit did not expire")
+	}
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func TestTimelimitPause(t *testing.T) {
+	ctx, cancel := withTimelimit(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ctx.pause()
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("the time limit expired while paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.NoError(t, ctx.Err())
+	assert.True(t, ctx.Remaining() > 0)
+
+	ctx.resume()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the time limit did not expire once resumed")
+	}
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+	assert.Equal(t, time.Duration(0), ctx.Remaining())
+}
+
+func TestTimelimitStaleTimer(t *testing.T) {
+	ctx, cancel := withTimelimit(context.Background(), time.Hour)
+	defer cancel()
+
+	// the timer of the first generation fires while the context is being
+	// paused and resumed
+	ctx.pause()
+	ctx.resume()
+	ctx.expire(0)
+	assert.NoError(t, ctx.Err())
+	assert.True(t, ctx.Remaining() > time.Minute)
+
+	ctx.expire(1)
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func TestTimelimitParentCanceled(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := withTimelimit(parent, time.Hour)
+	defer cancel()
+
+	ctx.pause()
+	cancelParent()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the parent cancellation was not propagated")
+	}
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
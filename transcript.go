@@ -0,0 +1,185 @@
+package docker
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// StdoutStream is the stream name used for the standard output
+	StdoutStream = "stdout"
+	// StderrStream is the stream name used for the standard error
+	StderrStream = "stderr"
+)
+
+// TranscriptEntry is a chunk of output written by an execution.
+type TranscriptEntry struct {
+	// Stream is the name of the stream the chunk was written to
+	Stream string `json:"stream"`
+	// Offset is the time elapsed since the transcript was started
+	Offset time.Duration `json:"offset"`
+	// Data holds the bytes of the chunk
+	Data []byte `json:"data"`
+}
+
+// Transcript records the output of an execution chunk by chunk along with the
+// stream each chunk was written to and when it was written. When the execution
+// runs with a tty, the daemon merges both streams and all chunks are recorded
+// as stdout.
+type Transcript struct {
+	mu      sync.Mutex
+	start   time.Time
+	Entries []TranscriptEntry
+}
+
+type transcriptWriter struct {
+	transcript *Transcript
+	stream     string
+}
+
+// NewTranscript returns an empty transcript whose offsets are relative to now.
+func NewTranscript() *Transcript {
+	return &Transcript{
+		start:   time.Now(),
+		Entries: []TranscriptEntry{},
+	}
+}
+
+func (w *transcriptWriter) Write(p []byte) (int, error) {
+	w.transcript.record(w.stream, p)
+	return len(p), nil
+}
+
+// Stdout returns a writer that records the chunks written to it as stdout.
+func (t *Transcript) Stdout() io.Writer {
+	return &transcriptWriter{transcript: t, stream: StdoutStream}
+}
+
+// Stderr returns a writer that records the chunks written to it as stderr.
+func (t *Transcript) Stderr() io.Writer {
+	return &transcriptWriter{transcript: t, stream: StderrStream}
+}
+
+func (t *Transcript) record(stream string, p []byte) {
+	data := make([]byte, len(p))
+	copy(data, p)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Entries = append(t.Entries, TranscriptEntry{
+		Stream: stream,
+		// time.Since uses the monotonic clock reading of start
+		Offset: time.Since(t.start),
+		Data:   data,
+	})
+}
+
+// Bytes returns the content of all streams in the order they were recorded.
+func (t *Transcript) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := []byte{}
+	for _, e := range t.Entries {
+		res = append(res, e.Data...)
+	}
+	return res
+}
+
+// WriteTo writes the transcript as JSON lines, one entry per line.
+func (t *Transcript) WriteTo(w io.Writer) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cw := &countingWriter{w: w}
+	enc := json.NewEncoder(cw)
+	for _, e := range t.Entries {
+		if err := enc.Encode(e); err != nil {
+			return cw.n, errors.Wrap(err, "failed to encode transcript entry")
+		}
+	}
+	return cw.n, nil
+}
+
+// ReadTranscript reads a transcript that was written as JSON lines by
+// Transcript.WriteTo.
+func ReadTranscript(r io.Reader) (*Transcript, error) {
+	t := NewTranscript()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e TranscriptEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, errors.Wrap(err, "failed to decode transcript entry")
+		}
+		t.Entries = append(t.Entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read transcript")
+	}
+	return t, nil
+}
+
+// Replay writes the recorded chunks to stdout and stderr in the order they
+// were recorded. If stderr is nil, the stderr chunks are written to stdout.
+// If realtime is true, Replay sleeps between chunks to reproduce the
+// original timing.
+func (t *Transcript) Replay(stdout, stderr io.Writer, realtime bool) error {
+	if stderr == nil {
+		stderr = stdout
+	}
+	t.mu.Lock()
+	entries := make([]TranscriptEntry, len(t.Entries))
+	copy(entries, t.Entries)
+	t.mu.Unlock()
+
+	start := time.Now()
+	for _, e := range entries {
+		if realtime {
+			if d := e.Offset - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		w := stdout
+		if e.Stream == StderrStream {
+			w = stderr
+		}
+		if _, err := w.Write(e.Data); err != nil {
+			return errors.Wrap(err, "failed to replay transcript")
+		}
+	}
+	return nil
+}
+
+// Transcript runs the command and returns a transcript of its standard output
+// and standard error.
+func (e *Execution) Transcript() (*Transcript, error) {
+	if e.Stdout != nil {
+		return nil, errors.New("Docker execution:: Stdout already set")
+	}
+	if e.Stderr != nil {
+		return nil, errors.New("Docker execution:: Stderr already set")
+	}
+	t := NewTranscript()
+	e.Stdout, e.Stderr = t.Stdout(), t.Stderr()
+	err := e.Run()
+	return t, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
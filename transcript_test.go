@@ -0,0 +1,37 @@
+package docker
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	tr := NewTranscript()
+	tr.Stdout().Write([]byte("compiling\n"))
+	tr.Stderr().Write([]byte("warning: unused variable\n"))
+	tr.Stdout().Write([]byte("done\n"))
+
+	assert.Equal(t, "compiling\nwarning: unused variable\ndone\n", string(tr.Bytes()))
+
+	var buf bytes.Buffer
+	_, err := tr.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("\n")))
+
+	read, err := ReadTranscript(&buf)
+	assert.NoError(t, err)
+	if !assert.Len(t, read.Entries, 3) {
+		return
+	}
+	assert.Equal(t, StderrStream, read.Entries[1].Stream)
+	assert.True(t, read.Entries[0].Offset <= read.Entries[1].Offset)
+	assert.True(t, read.Entries[1].Offset <= read.Entries[2].Offset)
+
+	var stdout, stderr bytes.Buffer
+	err = read.Replay(&stdout, &stderr, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "compiling\ndone\n", stdout.String())
+	assert.Equal(t, "warning: unused variable\n", stderr.String())
+}
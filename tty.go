@@ -98,31 +98,3 @@ func (c *Container) MonitorTtySize() error {
 func (e *Execution) MonitorTtySize() error {
 	return monitorTtySize(e.container, e, true)
 }
-
-func (c *Container) ForwardAllSignals() chan os.Signal {
-	sigc := make(chan os.Signal, 128)
-	signal.CatchAll(sigc)
-	go func() {
-		for s := range sigc {
-			if s == signal.SIGCHLD || s == signal.SIGPIPE {
-				continue
-			}
-			var sig string
-			for sigStr, sigN := range signal.SignalMap {
-				if sigN == s {
-					sig = sigStr
-					break
-				}
-			}
-			if sig == "" {
-				log.Errorf("Unsupported signal: %v. Discarding.\n", s)
-				continue
-			}
-
-			if err := c.killWithSignal(sig); err != nil {
-				log.WithError(err).Debug("sending signal")
-			}
-		}
-	}()
-	return sigc
-}
@@ -0,0 +1,312 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+)
+
+// The websocket bridge exchanges binary messages whose first byte identifies
+// the channel of the message and whose remaining bytes are the payload.
+const (
+	// WebSocketStdin carries input from the client to the process
+	WebSocketStdin byte = iota
+	// WebSocketStdout carries the standard output of the process
+	WebSocketStdout
+	// WebSocketStderr carries the standard error of the process
+	WebSocketStderr
+	// WebSocketResize carries a JSON encoded TerminalSize from the client
+	WebSocketResize
+	// WebSocketExit carries a JSON encoded WebSocketExitMessage to the
+	// client once the process finished. The connection is closed afterwards.
+	WebSocketExit
+)
+
+// WebSocketExitMessage is the payload of the WebSocketExit message
+type WebSocketExitMessage struct {
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	// Detached is true if the client detached from the execution, which
+	// keeps running in the container
+	Detached bool `json:"detached,omitempty"`
+}
+
+// WebSocketTarget is what a websocket connection is bridged to. Exactly one
+// of Container and Execution must be set. An Execution must not be started,
+// it is run interactively with a tty and is killed if the client disconnects.
+type WebSocketTarget struct {
+	Container *Container
+	Execution *Execution
+}
+
+// WebSocketAuthFunc authenticates the request before it is upgraded and
+// returns the target of the connection. The request is rejected with a 401
+// status if an error is returned.
+type WebSocketAuthFunc func(r *http.Request) (WebSocketTarget, error)
+
+type WebSocketOptions struct {
+	idleTimeout time.Duration
+	detachKeys  string
+}
+
+type WebSocketOption func(*WebSocketOptions)
+
+// WebSocketIdleTimeout closes the connection when no message was exchanged
+// for the given duration. A zero duration disables the timeout.
+func WebSocketIdleTimeout(d time.Duration) WebSocketOption {
+	return func(o *WebSocketOptions) {
+		o.idleTimeout = d
+	}
+}
+
+// WebSocketDetachKeys overrides the key sequence used to detach from an
+// execution. An empty string disables detaching.
+func WebSocketDetachKeys(keys string) WebSocketOption {
+	return func(o *WebSocketOptions) {
+		o.detachKeys = keys
+	}
+}
+
+type webSocketHandler struct {
+	authenticate WebSocketAuthFunc
+	options      WebSocketOptions
+}
+
+// NewWebSocketHandler returns an http handler that upgrades requests to
+// websockets and bridges them to the attach stream of a container or to an
+// execution. Since the handshake does not check the origin of the request,
+// the authentication function is responsible for doing so.
+func NewWebSocketHandler(authenticate WebSocketAuthFunc, paramOpts ...WebSocketOption) http.Handler {
+	opts := WebSocketOptions{
+		idleTimeout: 30 * time.Minute,
+		detachKeys:  DefaultDetachKeys,
+	}
+	for _, o := range paramOpts {
+		o(&opts)
+	}
+	return &webSocketHandler{
+		authenticate: authenticate,
+		options:      opts,
+	}
+}
+
+func (h *webSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authenticate == nil {
+		http.Error(w, "websocket authentication is not configured", http.StatusUnauthorized)
+		return
+	}
+	target, err := h.authenticate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if (target.Container == nil) == (target.Execution == nil) {
+		http.Error(w, "invalid websocket target", http.StatusInternalServerError)
+		return
+	}
+	server := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			newWebSocketBridge(ws, h.options).run(target)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+type webSocketBridge struct {
+	ws       *websocket.Conn
+	options  WebSocketOptions
+	mu       sync.Mutex
+	stdin    *io.PipeWriter
+	resize   chan TerminalSize
+	active   chan struct{}
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+func newWebSocketBridge(ws *websocket.Conn, opts WebSocketOptions) *webSocketBridge {
+	return &webSocketBridge{
+		ws:      ws,
+		options: opts,
+		resize:  make(chan TerminalSize, 1),
+		active:  make(chan struct{}, 1),
+		lost:    make(chan struct{}),
+	}
+}
+
+// disconnect records that the client is gone, either because the connection
+// was closed or because it was idle for too long
+func (b *webSocketBridge) disconnect() {
+	b.lostOnce.Do(func() {
+		close(b.lost)
+		b.stdin.CloseWithError(io.EOF)
+	})
+}
+
+func (b *webSocketBridge) run(target WebSocketTarget) {
+	defer b.ws.Close()
+
+	stdin, stdinWriter := io.Pipe()
+	b.stdin = stdinWriter
+	go b.receive()
+
+	done := make(chan struct{})
+	defer close(done)
+	go b.watchIdle(done)
+
+	stdout := &webSocketWriter{bridge: b, channel: WebSocketStdout}
+	stderr := &webSocketWriter{bridge: b, channel: WebSocketStderr}
+
+	var err error
+	detached := false
+	if target.Container != nil {
+		c := target.Container
+		go b.forwardResize(done, func(size TerminalSize) {
+			resizeTty(c, nil, size.Height, size.Width, false)
+		})
+		err = c.AttachStreams(stdin, stdout, stderr)
+	} else {
+		e := target.Execution
+		// do not leave the process behind once the client is gone, the
+		// execution kills its process when its context is canceled
+		ctx, cancel := context.WithCancel(e.context)
+		defer cancel()
+		e.context = ctx
+		go func() {
+			select {
+			case <-b.lost:
+				cancel()
+			case <-done:
+			}
+		}()
+		err = e.Interactive(stdin, stdout,
+			InteractiveDetachKeys(b.options.detachKeys),
+			InteractiveResize(b.resize),
+		)
+		if err == ErrDetached {
+			detached, err = true, nil
+		}
+	}
+
+	msg := WebSocketExitMessage{Detached: detached}
+	if detached {
+		msg.ExitCode = -1
+	}
+	if err != nil {
+		msg.ExitCode = -1
+		if ee, ok := errors.Cause(err).(*ExitError); ok {
+			msg.ExitCode = ee.ExitCode
+		}
+		msg.Error = err.Error()
+	} else if !detached && target.Execution != nil {
+		msg.ExitCode = target.Execution.ExitStatus().ExitCode
+	}
+	if bts, err := json.Marshal(msg); err == nil {
+		b.send(WebSocketExit, bts)
+	}
+}
+
+// receive reads the messages sent by the client until the connection is
+// closed.
+func (b *webSocketBridge) receive() {
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(b.ws, &msg); err != nil {
+			b.disconnect()
+			return
+		}
+		b.touch()
+		if len(msg) == 0 {
+			continue
+		}
+		switch msg[0] {
+		case WebSocketStdin:
+			if _, err := b.stdin.Write(msg[1:]); err != nil {
+				return
+			}
+		case WebSocketResize:
+			var size TerminalSize
+			if err := json.Unmarshal(msg[1:], &size); err != nil {
+				log.WithError(err).Debug("invalid websocket resize message")
+				continue
+			}
+			// only the latest size matters
+			select {
+			case <-b.resize:
+			default:
+			}
+			b.resize <- size
+		default:
+			log.WithField("channel", msg[0]).Debug("unexpected websocket message")
+		}
+	}
+}
+
+func (b *webSocketBridge) forwardResize(done <-chan struct{}, resize func(TerminalSize)) {
+	for {
+		select {
+		case <-done:
+			return
+		case size := <-b.resize:
+			resize(size)
+		}
+	}
+}
+
+// watchIdle closes the connection once no message was exchanged for the idle
+// timeout.
+func (b *webSocketBridge) watchIdle(done <-chan struct{}) {
+	if b.options.idleTimeout <= 0 {
+		return
+	}
+	timer := time.NewTimer(b.options.idleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-b.active:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(b.options.idleTimeout)
+		case <-timer.C:
+			log.Debug("closing idle websocket connection")
+			b.ws.Close()
+			b.disconnect()
+			return
+		}
+	}
+}
+
+func (b *webSocketBridge) touch() {
+	select {
+	case b.active <- struct{}{}:
+	default:
+	}
+}
+
+func (b *webSocketBridge) send(channel byte, p []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.touch()
+	return websocket.Message.Send(b.ws, append([]byte{channel}, p...))
+}
+
+type webSocketWriter struct {
+	bridge  *webSocketBridge
+	channel byte
+}
+
+func (w *webSocketWriter) Write(p []byte) (int, error) {
+	if err := w.bridge.send(w.channel, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
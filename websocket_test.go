@@ -0,0 +1,174 @@
+package docker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// webSocketTest bridges websocket connections to executions of the fake
+// daemon
+type webSocketTest struct {
+	*httptest.Server
+	cont    *Container
+	served  sync.WaitGroup
+	cleanup func()
+}
+
+func newWebSocketTest(t *testing.T, commands map[string]fakeCommand, routes map[string]http.HandlerFunc, opts ...WebSocketOption) *webSocketTest {
+	all := execRoutes(commands)
+	for key, route := range routes {
+		all[key] = route
+	}
+	d, client := newFakeDaemon(t, all)
+	options := NewContainerOptions(client)
+	res := &webSocketTest{
+		cont: &Container{ID: "c1", client: client, options: *options},
+	}
+	handler := NewWebSocketHandler(func(r *http.Request) (WebSocketTarget, error) {
+		if r.URL.Query().Get("token") != "secret" {
+			return WebSocketTarget{}, errors.New("invalid token")
+		}
+		e, err := NewExecution(res.cont, r.URL.Query().Get("cmd"))
+		return WebSocketTarget{Execution: e}, err
+	}, opts...)
+	res.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res.served.Add(1)
+		defer res.served.Done()
+		handler.ServeHTTP(w, r)
+	}))
+	res.cleanup = func() {
+		res.Server.Close()
+		res.served.Wait()
+		options.cancelFunc()
+		client.Close()
+		d.Close()
+	}
+	return res
+}
+
+func (wt *webSocketTest) dial(t *testing.T, cmd string) *websocket.Conn {
+	u := "ws" + strings.TrimPrefix(wt.URL, "http") + "/?token=secret&cmd=" + url.QueryEscape(cmd)
+	ws, err := websocket.Dial(u, "", wt.URL)
+	require.NoError(t, err)
+	return ws
+}
+
+// receiveAll returns the messages received until the connection is closed,
+// indexed by channel
+func receiveAll(t *testing.T, ws *websocket.Conn) map[byte]string {
+	res := map[byte]string{}
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return res
+		}
+		require.NotEmpty(t, msg)
+		res[msg[0]] += string(msg[1:])
+	}
+}
+
+func exitMessage(t *testing.T, msgs map[byte]string) WebSocketExitMessage {
+	res := WebSocketExitMessage{}
+	require.NoError(t, json.Unmarshal([]byte(msgs[WebSocketExit]), &res))
+	return res
+}
+
+// eventually fails the test if the condition is not met within 5 seconds
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketUnauthorized(t *testing.T) {
+	wt := newWebSocketTest(t, nil, nil)
+	defer wt.cleanup()
+
+	resp, err := http.Get(wt.URL + "/?token=guess")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestWebSocketExit(t *testing.T) {
+	wt := newWebSocketTest(t, map[string]fakeCommand{
+		"make": {Output: "1 failed\n", ExitCode: 2},
+	}, nil)
+	defer wt.cleanup()
+
+	ws := wt.dial(t, "make")
+	defer ws.Close()
+	msgs := receiveAll(t, ws)
+	assert.Equal(t, "1 failed\n", msgs[WebSocketStdout])
+	exit := exitMessage(t, msgs)
+	assert.Equal(t, 2, exit.ExitCode)
+	assert.False(t, exit.Detached)
+}
+
+func TestWebSocketStdinResizeDetach(t *testing.T) {
+	input := &lockedBuffer{}
+	var mu sync.Mutex
+	sizes := []string{}
+	wt := newWebSocketTest(t, map[string]fakeCommand{
+		"bash": {Output: "$ ", Stdin: true, Input: input, Running: time.Hour},
+	}, map[string]http.HandlerFunc{
+		"POST /exec/*/resize": func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			sizes = append(sizes, r.URL.Query().Get("h")+"x"+r.URL.Query().Get("w"))
+		},
+	})
+	defer wt.cleanup()
+
+	ws := wt.dial(t, "bash")
+	defer ws.Close()
+	var prompt []byte
+	require.NoError(t, websocket.Message.Receive(ws, &prompt))
+	assert.Equal(t, append([]byte{WebSocketStdout}, "$ "...), prompt)
+
+	require.NoError(t, websocket.Message.Send(ws, append([]byte{WebSocketStdin}, "ls\n"...)))
+	require.NoError(t, websocket.Message.Send(ws, append([]byte{WebSocketResize}, `{"height":24,"width":80}`...)))
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sizes) == 1 && sizes[0] == "24x80"
+	})
+	eventually(t, func() bool {
+		return string(input.Bytes()) == "ls\n"
+	})
+
+	require.NoError(t, websocket.Message.Send(ws, []byte{WebSocketStdin, 0x10, 0x11}))
+	exit := exitMessage(t, receiveAll(t, ws))
+	assert.True(t, exit.Detached)
+	assert.Empty(t, exit.Error)
+}
+
+func TestWebSocketIdleTimeout(t *testing.T) {
+	wt := newWebSocketTest(t, map[string]fakeCommand{
+		"bash": {Stdin: true, Running: time.Hour},
+	}, nil, WebSocketIdleTimeout(100*time.Millisecond))
+	defer wt.cleanup()
+
+	ws := wt.dial(t, "bash")
+	defer ws.Close()
+	start := time.Now()
+	msgs := receiveAll(t, ws)
+	assert.Empty(t, msgs[WebSocketExit])
+	assert.True(t, time.Since(start) < 5*time.Second)
+}